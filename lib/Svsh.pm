@@ -1,15 +1,22 @@
 package Svsh;
 
-# ABSTRACT: Process supervision shell for daemontools/perp/s6/runit
+# ABSTRACT: Process supervision shell for daemontools/perp/s6/s6-rc/runit/nosh/dinit/systemd/OpenRC
 
 our $VERSION = "1.002000";
 $VERSION = eval $VERSION;
 
 use Moo::Role;
 
+use Config;
+use Cwd ();
+use File::Spec;
+use IO::Select;
+use POSIX ();
+use Time::HiRes ();
+
 =head1 NAME
 
-Svsh - Process supervision shell for daemontools/perp/s6/runit (base class)
+Svsh - Process supervision shell for daemontools/perp/s6/s6-rc/runit/nosh/dinit/systemd/OpenRC (base class)
 
 =head1 SYNOPSIS
 
@@ -24,9 +31,13 @@ Svsh - Process supervision shell for daemontools/perp/s6/runit (base class)
 
 =head1 DESCRIPTION
 
-C<svsh> is a shell for process supervision suites of the C<daemontools> family,
-including C<perp>, C<s6> and C<runit>. Refer to L<svsh> for documentation of
-the shell itself. This file documents the base class for Svsh adapter classes.
+C<svsh> is a shell for process supervision suites of the C<daemontools> family
+(C<daemontools> itself, C<perp>, C<s6>, C<s6-rc>, C<runit> and C<nosh>), for
+C<dinit>, and for the C<systemd> and C<OpenRC> service managers. Refer to
+L<svsh> for documentation of the shell itself. This file documents the base
+class for Svsh adapter classes, of which there is one per supported suite:
+L<Svsh::Daemontools>, L<Svsh::Perp>, L<Svsh::S6>, L<Svsh::S6rc>, L<Svsh::Runit>,
+L<Svsh::Nosh>, L<Svsh::Dinit>, L<Svsh::Systemd> and L<Svsh::Openrc>.
 
 =head1 ATTRIBUTES
 
@@ -57,6 +68,67 @@ has 'bindir' => (
 	is => 'ro'
 );
 
+=head2 host
+
+I<Read-Only>.
+
+A host (e.g. C<user@server>) on which the process supervisor is running. If
+provided, the supervisor's tools are executed on that host over SSH (with the
+C<ssh> program, so the user's SSH configuration and keys apply), and the base
+directory (and C<bindir>) are paths on that host. Features which inspect the
+process table of the host (the C<wide> attribute, C<terminate()>, and everything
+about the supervisor process itself) are not supported remotely.
+
+=cut
+
+has 'host' => (
+	is => 'ro'
+);
+
+=head2 runner
+
+I<Read-Only>.
+
+A code reference which runs the commands whose output is captured (see
+L<run_cmd()|/"run_cmd( $cmd, [ @args ] )"> and L<run_cmds()|/"run_cmds( \@cmd, [ \@cmd, ... ], [ \%options ] )">)
+instead of executing them. It receives the command and its arguments, and
+returns the command's output. Commands aren't checked to exist when a runner
+is provided, so it can be used to test adapters with canned outputs of the
+supervisor's tools, without having them installed:
+
+	my $svsh = Svsh::Runit->new(
+		basedir => '/etc/service',
+		runner => sub { "run: $_[2]: (pid 123) 45s\n" }
+	);
+
+=cut
+
+has 'runner' => (
+	is => 'ro'
+);
+
+=head2 logger
+
+I<Read-Only>.
+
+A code reference which traces the commands run by
+L<run_cmd()|/"run_cmd( $cmd, [ @args ] )"> and L<run_cmds()|/"run_cmds( \@cmd, [ \@cmd, ... ], [ \%options ] )">.
+If provided, it receives a line for every command run in L<debug> mode, with
+its arguments, exit status and output (truncated to 200 characters), which
+helps with debugging why a command failed:
+
+	my $svsh = Svsh::Runit->new(
+		basedir => '/etc/service',
+		debug => 1,
+		logger => sub { print STDERR @_ }
+	);
+
+=cut
+
+has 'logger' => (
+	is => 'ro'
+);
+
 =head2 collapse
 
 I<Read-Write>.
@@ -71,21 +143,173 @@ has 'collapse' => (
 	default => sub { 0 }
 );
 
+=head2 debug
+
+I<Read-Write>.
+
+A boolean indicating whether debug mode is enabled. In debug mode, the raw
+output of the supervisor's status tool is kept for services whose status
+could not be parsed.
+
+=cut
+
+has 'debug' => (
+	is => 'rw',
+	default => sub { 0 }
+);
+
+=head2 wide
+
+I<Read-Write>.
+
+A boolean indicating whether extra information should be gathered about
+services. Currently, when enabled, the process ID of the process supervising
+every service (e.g. C<runsv> or C<s6-supervise>) is added to its status
+under the C<supervise_pid> key.
+
+=cut
+
+has 'wide' => (
+	is => 'rw',
+	default => sub { 0 }
+);
+
+=head2 dry_run
+
+I<Read-Write>.
+
+A boolean indicating whether commands which change the state of services
+should only be printed (i.e. returned as output, prefixed with C<Would run:>)
+rather than executed. Commands which only query the state of services still
+run, so statuses can be read. Adapter classes declare the commands of their
+supervisor which only query it in a C<@QUERIES> package variable, as the
+prefixes of their command lines (e.g. C<sv status>).
+
+=cut
+
+has 'dry_run' => (
+	is => 'rw',
+	default => sub { 0 }
+);
+
+=head2 only
+
+I<Read-Write>.
+
+A wildcard pattern (see L<expand_wildcards()|/"expand_wildcards( @services )">)
+limiting the services the shell sees to those matching it, e.g. C<web-*>.
+Services outside it are dropped from the results of C<status()>, and from
+the lists of services expanded by L<expand_wildcards()|/"expand_wildcards( @services )">,
+so commands don't touch them even when named explicitly. See L<in_scope()|/"in_scope( $service )">.
+
+=cut
+
+has 'only' => (
+	is => 'rw'
+);
+
+=head2 exclude
+
+I<Read-Write>.
+
+A wildcard pattern hiding the services matching it, the same way services
+not matching L<only> are hidden.
+
+=cut
+
+has 'exclude' => (
+	is => 'rw'
+);
+
+=head2 status_concurrency
+
+I<Read-Only>.
+
+The maximum number of status commands to run in parallel, for suites whose
+status tool is run once per service (e.g. C<sv status> or C<s6-svstat>).
+Defaults to the number of services, up to 16. Lower it on small machines
+to avoid load spikes, raise it on big hosts with many services.
+
+=cut
+
+has 'status_concurrency' => (
+	is => 'ro'
+);
+
+=head2 groups
+
+I<Read-Only>.
+
+A hash-ref of named groups of services, i.e. of group names and array-refs of
+the services (possibly with wildcards) belonging to them. Groups are referred
+to by their names prefixed with C<@> (e.g. C<@frontend>) in the lists of
+services expanded by L<expand_wildcards()|/"expand_wildcards( @services )">.
+
+=cut
+
+has 'groups' => (
+	is => 'ro',
+	default => sub { {} }
+);
+
+=head2 status_ttl
+
+I<Read-Only>.
+
+How many seconds (may be fractional) the statuses read by C<status()> are
+fresh enough for L<cached_status()|/"cached_status()">, e.g. for autocompletion.
+Defaults to 1, C<0> disables caching.
+
+=cut
+
+has 'status_ttl' => (
+	is => 'ro',
+	default => sub { 1 }
+);
+
+# when the statuses were last read
+has '_status_read_at' => (
+	is => 'rw',
+	clearer => '_clear_status_read_at'
+);
+
+# whether the statuses are kept for cached_status() until
+# refreshed, however old they are
+has '_status_kept' => (
+	is => 'rw'
+);
+
+# whether status() is only called to peek at the statuses of a
+# few services, leaving the statuses attribute alone
+has '_status_peek' => (
+	is => 'rw'
+);
+
 =head2 statuses
 
 I<Read-Only>.
 
 A hash-ref of services and their statuses (this is automatically populated by
-the respective C<status()> method in the adapter classes. For every service,
+the respective C<status()> method in the adapter classes). It is also built
+on first access if C<status()> was not called yet, so that wildcards work in
+one-shot commands, which don't start with a C<status()> call. For every service,
 a hash-ref with C<status>, C<duration> and C<pid> keys should exist.
 
+Services whose status output could not be parsed are not dropped; they are
+listed with an C<unknown> status and a true C<parse_error> key (plus a C<raw>
+key holding the unparsed output, in L<debug> mode).
+
 =cut
 
 has 'statuses' => (
 	is => 'ro',
+	lazy => 1,
+	builder => '_build_statuses',
 	writer => '_set_statuses'
 );
 
+sub _build_statuses { shift->status }
+
 =head1 REQUIRED METHODS
 
 =head2 status()
@@ -93,10 +317,29 @@ has 'statuses' => (
 Finds all services managed by the supervisor, and populates
 the L<statuses> attribute.
 
+The statuses of services reporting the same process ID (e.g. a
+service directory linked twice, or a stale status) are flagged
+by the role with a true C<duplicate_pid> value.
+
+Adapters whose status tool reports which state the supervisor wants a
+service in add it under the C<want> key (C<up> or C<down>). A service
+that is C<down> but wanted C<up> is failing to stay up, while a service
+that is C<down> and wanted C<down> was stopped on purpose. Adapters whose
+supervisor counts how many times services were restarted add the count
+under the C<restarts> key. Adapters whose supervisor runs a logger process
+alongside services add its state under the C<log> key (C<up> or C<down>),
+and its process ID under the C<log_pid> key, for services that have one.
+
 =head2 start( @services )
 
 Starts a list of services if they are down.
 
+C<start>, C<stop> and C<restart> receive their list of services in the
+C<args> key of the parameters hash-ref (the third argument). If the
+adapter can wait for the command to take effect by itself (see
+L<native_wait()|/"native_wait( $command )">), the C<wait> key of the
+parameters might hold the number of seconds to wait for at most.
+
 =head2 stop( @services )
 
 Stops a list of services (should not restart them).
@@ -109,54 +352,241 @@ adapter class.
 
 =head2 signal( $signal, @services )
 
-Sends UNIX signal to a list of services.
+Sends UNIX signal to a list of services. Adapter classes declare the
+signals they support (and how to send them) in an C<%SIGNALS> package
+variable, mapping signal names (without the C<SIG> prefix) to the
+argument of the supervisor's tool that sends them. Signals missing from
+it, including signal numbers (e.g. C<10>) and real-time signals (e.g.
+C<RTMIN+3> or C<RTMAX-1>), are sent directly to the services' processes,
+as long as the system knows them; others are rejected with an error naming
+the suite and the signal.
 
-=head2 fg( $service )
+=head2 fg( @services )
 
-Finds the log file to which a service is writing, and displays it
-on screen with the C<tail -f> command.
+Finds the log files to which a list of services are writing, and displays
+them on screen with the L<follow_logs()|/"follow_logs( \%logfiles, [ \%options ] )">
+method. Adapters whose services log to files should do so with
+L<logfile()|/"logfile( $service )">, passing along the C<lines> and C<since>
+parameters.
 
 =head1 WANTED METHODS
 
 These methods are not required by adapter classes. If they are not
 implemented, they will be unavailable in the shell.
 
+=head2 status_of( $service )
+
+Returns the status of one service (a hash-ref, like the values of
+the L<statuses> attribute), querying the supervisor about that service
+only rather than about all of them. Dies with a C<No such service>
+error if the service's directory doesn't exist, which callers can tell
+apart from a status that could not be parsed (an C<unknown> status).
+The role provides a default implementation calling C<status()>, which
+adapters should override.
+
+=head2 statuses_of( @services )
+
+Returns the statuses of a list of services (a hash-ref, like the
+L<statuses> attribute, but without changing it), querying the supervisor
+about these services only, which is faster than C<status()> when only a
+few of many services are of interest. Dies with a C<No such service>
+error if one of them doesn't exist. The role provides a default
+implementation calling C<status()> once, and picking the services from its
+result (without changing the L<statuses> attribute); adapters whose status
+tool runs once per service should query only these services, in parallel.
+Such adapters should also override the (internal) C<_checks_existence()>
+method to return false, so that the services are checked to exist first.
+
 =head2 rescan()
 
 Causes the supervisor to rescan the service directory to find
 new or removed services.
 
-=head2 terminate()
+=head2 reset( @services )
+
+Clears the backoff/restart-throttling state of a list of services, and
+triggers an immediate attempt to start them. Useful for services stuck
+in backoff.
+
+=head2 once( @services )
+
+Starts a list of services, without restarting them when they exit.
+
+=head2 force_stop( @services )
+
+Stops a list of services immediately, killing their processes (with
+C<SIGKILL>) rather than waiting for them to shut down gracefully, and
+making sure the supervisor doesn't restart them.
+
+=head2 logfile( $service )
+
+Returns the log file to which a service is currently writing, usually by
+finding its logging process and calling L<find_logfile()|/"find_logfile( $pid )">
+with it. Dies if the log file can't be found.
+
+=head2 enable( @services ) / disable( @services )
+
+Persistently enables or disables a list of services, i.e. changes whether
+the supervisor starts them when it (or their supervisor) starts, without
+starting or stopping them now. Suites of the daemontools family do this
+with C<down> files, which the (internal) C<_down_files()> method manages.
+
+=head2 terminate( [ $dir ] )
 
 Terminates the supervisor. Should also terminate all running services.
+Adapters may support terminating a nested supervision tree by providing
+its directory (relative paths are relative to the base directory), in which
+case only the supervisor of that tree is terminated.
 
 =cut
 
 requires qw/status start stop restart signal fg/;
 
+sub status_of {
+	return $_[0]->status->{$_[1]};
+}
+
+before status_of => sub {
+	my ($self, $service) = @_;
+
+	die "No such service: $service\n"
+		unless $self->_has_service($service);
+};
+
+sub statuses_of {
+	my ($self, @services) = @_;
+
+	# read all statuses once, which also tells which services exist
+	$self->_status_peek(1);
+	my $statuses = eval { $self->status };
+	$self->_status_peek(0);
+	die $@ unless $statuses;
+
+	foreach (@services) {
+		die "No such service: $_\n"
+			unless $statuses->{$_};
+	}
+
+	return { map { $_ => $statuses->{$_} } @services };
+}
+
+# whether statuses_of() checks that the services exist by itself,
+# as the default implementation does
+sub _checks_existence { 1 }
+
+around statuses_of => sub {
+	my ($orig, $self, @services) = @_;
+
+	# the default implementation checks the services exist by
+	# itself; for others, list the service directories once
+	# remotely rather than once per service
+	unless ($self->_checks_existence) {
+		my %exists = $self->host ? map { $_ => 1 } $self->_service_dirs : ();
+		foreach (@services) {
+			die "No such service: $_\n"
+				unless $self->host ? $exists{$_} : $self->_has_service($_);
+		}
+	}
+
+	return $self->_flag_statuses($orig->($self, @services));
+};
+
 before [qw/start stop restart/] => sub {
-	$_[2]->{args} = [$_[0]->_expand_wildcards(@{$_[2]->{args}})];
+	$_[2]->{args} = [$_[0]->expand_wildcards(@{$_[2]->{args}})];
 };
 
-before signal => sub {
-	my ($signal, @svcs) = @{$_[2]->{args}};
-	$_[2]->{args} = [$signal, $_[0]->_expand_wildcards(@svcs)];
+around signal => sub {
+	my ($orig, $self, $term, $parms) = @_;
+
+	my ($signal, @svcs) = @{$parms->{args}};
+	@svcs = $self->expand_wildcards(@svcs);
+	$parms->{args} = [$signal, @svcs];
+
+	my $name = uc($signal);
+	$name =~ s/^SIG//;
+
+	# signals the supervisor can't send are sent to the processes
+	# directly, unknown ones are left for the adapter to reject
+	my $number = exists $self->_signals->{$name} ? undef : $self->_signal_number($name);
+
+	return defined $number ?
+		$self->_kill($number, @svcs) :
+		$orig->($self, $term, $parms);
 };
 
 around 'status' => sub {
 	my ($orig, $self) = (shift, shift);
-	$self->_set_statuses($orig->($self, @_));
+	my $statuses = $orig->($self, @_);
+
+	delete @$statuses{grep { !$self->in_scope($_) } keys %$statuses}
+		if defined $self->only || defined $self->exclude;
+
+	# statuses_of() flags the statuses it returns itself
+	return $statuses
+		if $self->_status_peek;
+
+	$statuses = $self->_flag_statuses($statuses);
+
+	$self->_set_statuses($statuses);
+	$self->_status_read_at(Time::HiRes::time());
 	return $self->statuses;
 };
 
 =head1 METHODS
 
+=head2 name()
+
+Returns the name of the supervision suite (e.g. C<runit> or C<s6>), i.e. the
+lowercased name of the adapter class, as accepted by C<svsh>'s C<--suite>
+option. May be called on the class too.
+
+=cut
+
+sub name {
+	lc((split(/::/, ref $_[0] || $_[0]))[-1]);
+}
+
+=head2 suite_version()
+
+Returns the version of the supervision suite, as printed by the command in
+the C<@VERSION_COMMAND> package variable of the adapter class (e.g.
+C<systemctl --version>), or nothing if the suite's tools don't report their
+version (as with C<runit>, C<s6> and C<daemontools>), or the command fails.
+
+=cut
+
+sub suite_version {
+	my $self = shift;
+
+	my @cmd = do {
+		no strict 'refs';
+		@{(ref $self || $self).'::VERSION_COMMAND'};
+	};
+	return unless scalar @cmd;
+
+	my $output = eval { scalar $self->run_cmd(@cmd) };
+	return unless defined $output && $? == 0;
+
+	# only the version number of the first line, e.g. 252
+	# of "systemd 252 (252.22-1)"
+	my ($line) = split(/\n/, $output);
+	my ($version) = ($line || '') =~ m/(\d+(?:\.\d+)*)/;
+
+	return $version;
+}
+
 =head2 run_cmd( $cmd, [ @args ] )
 
-Runs a shell command with zero or more arguments and returns its
-output. If the C<bindir> attribute is set, and the C<$cmd> is one
+Runs a command with zero or more arguments and returns its output
+(standard output and error combined; a list of lines in list context).
+Dies with a helpful error message if the command can't be found.
+The command is executed directly rather than through the shell, so
+arguments are never split or interpolated, and in the C locale (C<LC_ALL=C>),
+so its output is never translated to the user's language. If the C<bindir> attribute is set, and the C<$cmd> is one
 of the supervision suite's library of tools, C<$cmd> will be prefixed
-with C<bindir>.
+with C<bindir>. If the C<host> attribute is set, the command is executed
+on that host over SSH. If the C<runner> attribute is set, the command is
+passed to it instead.
 
 =cut
 
@@ -165,27 +595,75 @@ sub run_cmd {
 
 	my $options = {};
 
-	$cmd = $self->bindir . '/' . $cmd
-		if $self->bindir && $cmd =~ m/^(perp|s6|sv)/;
-
 	if (scalar @args && ref $args[-1]) {
 		$options = pop @args;
 	}
 
-	if ($options->{as_system}) {
-		system($cmd, @args);
+	$cmd = $self->_resolve_cmd($cmd);
+
+	if ($options->{as_system} && $self->_executes($cmd, @args)) {
+		system($self->_command_line($cmd, @args));
 	} else {
-		$cmd = join(' ', $cmd, @args);
-		return qx/$cmd 2>&1/;
+		my $fh = $self->_capture($cmd, @args);
+		my @output = <$fh>;
+		$? = 0 if close $fh;
+		$self->_trace($cmd, \@args, join('', @output));
+		return wantarray ? @output : join('', @output);
+	}
+}
+
+=head2 run_cmds( \@cmd, [ \@cmd, ... ], [ \%options ] )
+
+Runs several commands (each an array reference of a command and its
+arguments, as taken by L<run_cmd()|/"run_cmd( $cmd, [ @args ] )">) in
+parallel, and returns a list of their outputs, in the same order. At most
+C<concurrency> commands (an option, defaulting to the number of commands,
+up to 16) run at any given time.
+
+=cut
+
+sub run_cmds {
+	my ($self, @cmds) = @_;
+
+	my $options = scalar @cmds && ref $cmds[-1] eq 'HASH' ? pop @cmds : {};
+
+	my $concurrency = $options->{concurrency} || (scalar @cmds < 16 ? scalar @cmds : 16);
+
+	my (@handles, @outputs);
+	my $collect = sub {
+		my $j = shift;
+		$outputs[$j] = _slurp($handles[$j]);
+		$self->_trace($cmds[$j]->[0], [@{$cmds[$j]}[1 .. $#{$cmds[$j]}]], $outputs[$j]);
+	};
+
+	foreach my $i (0 .. $#cmds) {
+		# keep at most $concurrency commands running, by
+		# collecting the output of the oldest one first
+		my $j = $i - $concurrency;
+		$collect->($j)
+			if $j >= 0;
+
+		my ($cmd, @args) = @{$cmds[$i]};
+		$handles[$i] = $self->_capture($self->_resolve_cmd($cmd), @args);
+	}
+
+	foreach my $j (0 .. $#cmds) {
+		$collect->($j)
+			unless defined $outputs[$j];
 	}
+
+	return @outputs;
 }
 
 =head2 find_logfile( $pid )
 
 Finds the log file into which a logging program is currently
 writing to. C<$pid> is the process ID of the logging program.
-Currently, C<tinylog>, C<s6-log>, C<svlogd> and C<multilog>
-are supported.
+Currently, C<tinylog>, C<s6-log>, C<svlogd>, C<multilog> and
+C<cyclog> are supported.
+
+The program and its open files are read from C</proc>; on systems
+without it (e.g. FreeBSD or macOS), C<lsof> is used instead.
 
 Returns C<undef> if the file is not found.
 
@@ -194,57 +672,1350 @@ Returns C<undef> if the file is not found.
 sub find_logfile {
 	my ($self, $pid) = @_;
 
-	my $exe = readlink("/proc/$pid/exe")
-		|| return;
+	my ($exe, @files) = $self->_has_proc ? $self->_proc_files($pid) : $self->_lsof_files($pid);
+
+	return unless $exe;
 
 	my $file;
 
-	if ($exe =~ m/tinylog/ || $exe =~ m/s6-log/ || $exe =~ m/svlogd/ || $exe =~ m/multilog/) {
-		# look for a link to a /current file under /proc/$pid/fd
-		opendir my $dir, "/proc/$pid/fd";
-		($file) = grep { m!/current$! } map { readlink("/proc/$pid/fd/$_") } grep { !/^\.\.?$/ } readdir $dir;
-		closedir $dir;
+	if ($exe =~ m/tinylog/ || $exe =~ m/s6-log/ || $exe =~ m/svlogd/ || $exe =~ m/multilog/ || $exe =~ m/cyclog/) {
+		# look for an open /current file
+		($file) = grep { m!/current$! } @files;
 	}
 
 	return $file;
 }
 
-######################################################################
-# _expand_wildcards( @services )
-# goes over a list of services, possibly (but not necessarily)
-# with wildcards, and returns a new list with all services
-# that match. For example, if @services = ('sv1', 'sv2', 'worker*'),
-# and the services worker-1 and worker-2 exist, then the
-# method will return ('sv1', 'sv2', 'worker-1', 'worker-2')
-######################################################################
+=head2 find_supervisor_logfile()
+
+Finds the log file into which the output of the supervisor itself
+(e.g. C<runsvdir> or C<s6-svscan>) is written. The supervisor process
+is found by its command line, and its standard output (or error) is
+examined: if it is a file, that file is returned; if it is a pipe or
+a FIFO, the logging program reading from it (e.g. the C<s6-svscan>
+catch-all logger) is found, and its log file is returned (see
+L<find_logfile()|/"find_logfile( $pid )">).
+
+Dies if the supervisor or its log file can't be found.
 
-sub _expand_wildcards {
+=cut
+
+sub find_supervisor_logfile {
 	my $self = shift;
 
-	my %services;
-	foreach (@_) {
-		if (m/\*/) {
-			# this is a wildcard, find all services that match it
-			my $regex = $_; $regex =~ s/\*/.*/; $regex = qr/^$regex$/;
-			foreach my $sv (grep { m/$regex/ } keys %{$self->statuses}) {
-				$services{$sv} = 1;
-			}
-		} else {
-			$services{$_} = 1;
+	my @processes = $self->_processes;
+	my $pid = $self->_supervisor_pid(@processes);
+
+	my ($output) = grep { defined } map { readlink("/proc/$pid/fd/$_") } (1, 2)
+		or die "Can't figure out where the supervisor's output goes";
+
+	return $output
+		if -f $output;
+
+	# the output is a pipe or FIFO, find the logger reading from it
+	my ($logger) = grep {
+		my $input = readlink("/proc/$_->{pid}/fd/0");
+		$_->{pid} != $pid && defined $input && $input eq $output;
+	} @processes
+		or die "Can't find the process logging the supervisor's output";
+
+	return $self->find_logfile($logger->{pid})
+		|| die "Can't find out the supervisor's log file";
+}
+
+=head2 supervisor_uptime()
+
+Returns the number of seconds since the supervisor process (e.g. C<runsvdir>
+or C<s6-svscan>) was started. Services that have been up for (about) as long
+came up with the supervisor, others have been restarted since.
+
+Dies if the supervisor can't be found.
+
+=cut
+
+sub supervisor_uptime {
+	my $self = shift;
+
+	my $pid = $self->_supervisor_pid($self->_processes);
+
+	# the start time of a process is the 22nd field of its stat
+	# file, in clock ticks since boot. the second field is the
+	# name of the program, which may contain spaces, so count
+	# fields from the end of that field
+	open(my $stat, '<', "/proc/$pid/stat") || die "Can't read the status of process $pid: $!";
+	my ($fields) = <$stat> =~ m/\)\s+(.*)$/;
+	close $stat;
+
+	open(my $uptime, '<', '/proc/uptime') || die "Can't read the system uptime: $!";
+	my ($boot) = split(/\s+/, <$uptime>);
+	close $uptime;
+
+	my $started = (split(/\s+/, $fields))[19] / POSIX::sysconf(POSIX::_SC_CLK_TCK());
+
+	return int($boot - $started);
+}
+
+=head2 proc_stats( $pid )
+
+Returns a hash-ref with the resource usage of a process: C<cpu>, the CPU time
+it used so far (user and system, in seconds), and C<rss>, its resident memory
+(in kilobytes). These are read from F</proc> when the host has it, and from
+C<ps> otherwise (e.g. on BSDs). Returns C<undef> if the process doesn't exist.
+
+=cut
+
+sub proc_stats {
+	my ($self, $pid) = @_;
+
+	if ($self->host || !$self->_has_proc) {
+		my ($rss, $time) = split(/\s+/, $self->run_cmd('ps', '-o', 'rss=,time=', '-p', $pid) =~ s/^\s+//r);
+		return unless defined $time;
+
+		# CPU times are in [[days-]hours:]minutes:seconds
+		my ($days, $clock) = $time =~ m/^(?:(\d+)-)?(.*)$/;
+		my $cpu = 0;
+		$cpu = $cpu * 60 + $_ foreach split(/:/, $clock);
+		return { cpu => ($days || 0) * 86400 + $cpu, rss => int($rss) };
+	}
+
+	# the user and system times are the 14th and 15th fields of the
+	# stat file (counting from the end of the program's name, which
+	# may contain spaces, as for supervisor_uptime())
+	open(my $stat, '<', "/proc/$pid/stat") || return;
+	my ($fields) = <$stat> =~ m/\)\s+(.*)$/;
+	close $stat;
+	my ($utime, $stime) = (split(/\s+/, $fields))[11, 12];
+
+	my $rss = 0;
+	if (open(my $status, '<', "/proc/$pid/status")) {
+		while (my $line = <$status>) {
+			$rss = $1 if $line =~ m/^VmRSS:\s+(\d+)/;
 		}
+		close $status;
 	}
 
-	return keys %services;
+	return { cpu => ($utime + $stime) / POSIX::sysconf(POSIX::_SC_CLK_TCK()), rss => int($rss) };
 }
 
-#########################################################
-# _service_dirs()
-# returns a list of all service directories inside the
-# base directory
-#########################################################
+=head2 validate()
 
-sub _service_dirs {
-	my $basedir = shift->basedir;
+Makes sure the base directory exists, and that the supervisor's control
+tool (as named by the C<$CONTROL_TOOL> package variable of the adapter
+class, e.g. C<sv> for C<runit>) is installed, dying with an actionable
+message otherwise. Neither can be checked on remote hosts. Useful before
+running any command, as a missing base directory or tool would make every
+command fail with a more confusing error.
+
+=cut
+
+sub validate {
+	my $self = shift;
+
+	return 1 if $self->host;
+
+	die "Base directory ".$self->basedir." does not exist or is not a directory\n"
+		unless -d $self->basedir;
+
+	my $tool = do {
+		no strict 'refs';
+		${(ref $self || $self).'::CONTROL_TOOL'};
+	};
+	$self->_resolve_cmd($tool)
+		if $tool;
+
+	return 1;
+}
+
+=head2 logs( $service, [ $lines ] )
+
+Returns the last C<$lines> lines (50 by default) of the log of a service,
+without following it. The log file is found with the adapter's
+L<logfile()|/"logfile( $service )"> method, and read with C<tail>.
+
+=cut
+
+sub logs {
+	my ($self, $service, $lines) = @_;
+
+	die ref($self)." can't find the log files of services\n"
+		unless $self->can('logfile');
+
+	return $self->run_cmd('tail', '-n', $lines || 50, $self->logfile($service));
+}
+
+=head2 follow_log( $logfile, [ \%options ] )
+
+Follows a log file (with C<tail -f>), writing every new line to
+the C<out> option (a file handle, defaults to C<STDOUT>), until
+the user hits C<Ctrl+C>, or until the C<cancel> option (a code
+reference called periodically) returns a true value. This allows
+the log to be displayed elsewhere than the terminal, e.g. in a
+pane of an embedding program, and to stop following it at will.
+
+The C<lines> option sets how many of the last lines of the log are
+displayed before following it (C<tail>'s default of 10 otherwise).
+The C<since> option (a number of seconds) displays all the lines
+logged since then instead, which requires log lines to be prefixed
+with TAI64N timestamps (as written by C<svlogd -t> or C<s6-log t>);
+the method dies if they aren't. The C<human_time> option replaces
+these timestamps with local times, with
+L<humanize_tai64n()|/"humanize_tai64n( $line )">.
+
+=cut
+
+sub follow_log {
+	my ($self, $logfile, $options) = @_;
+
+	$self->follow_logs({ $logfile => $logfile }, $options);
+}
+
+=head2 follow_logs( \%logfiles, [ \%options ] )
+
+Follows several log files at once, like L<follow_log()|/"follow_log( $logfile, [ \%options ] )">
+(and with the same options). C<\%logfiles> maps names (usually of services) to
+log files. When following more than one log file, their lines are interleaved
+as they are written, each prefixed with the name of its log file in brackets
+(e.g. C<[nginx]>). Prefixes are padded to the longest name, so lines align, and
+names longer than C<$PREFIX_WIDTH> characters (16 by default) are truncated,
+so they don't eat into narrow terminals. A single C<Ctrl+C> stops following
+all of them.
+
+=cut
+
+our $PREFIX_WIDTH = 16;
+
+sub follow_logs {
+	my ($self, $logfiles, $options) = @_;
+
+	$options ||= {};
+	my $out = $options->{out} || \*STDOUT;
+	my $cancel = $options->{cancel} || sub { 0 };
+
+	# lines can only be filtered by time if they are timestamped
+	my $cutoff;
+	if (defined $options->{since}) {
+		foreach (sort keys %$logfiles) {
+			my $last = $self->run_cmd('tail', '-n', 1, $logfiles->{$_});
+			die "The log of $_ has no TAI64N timestamps, can't show it since a time\n"
+				if length $last && !defined $self->decode_tai64n($last);
+		}
+		$cutoff = Time::HiRes::time() - $options->{since};
+	}
+
+	my @from = defined $cutoff ? ('-n', '+1') :
+		defined $options->{lines} ? ('-n', $options->{lines}) : ();
+
+	# one tail process per log file
+	my $prefix = scalar keys %$logfiles > 1;
+	my ($width) = sort { $b <=> $a } map { length } keys %$logfiles;
+	$width = $PREFIX_WIDTH if $width > $PREFIX_WIDTH;
+	my $tail = $self->_resolve_cmd('tail');
+	my (%names, %buffers, %started, @pids);
+	my $select = IO::Select->new;
+	foreach (sort keys %$logfiles) {
+		my ($fh, $pid) = $self->_spawn($tail, @from, '-f', $logfiles->{$_});
+		$names{$fh} = !$prefix ? '' :
+			length > $width ? '['.substr($_, 0, $width - 1)."\xe2\x80\xa6] " :
+			sprintf('%-*s ', $width + 2, "[$_]");
+		$buffers{$fh} = '';
+		$started{$fh} = !defined $cutoff;
+		push(@pids, $pid);
+		$select->add($fh);
+	}
+
+	# Ctrl+C should stop following, not quit the shell
+	my $interrupted = 0;
+	local $SIG{INT} = sub { $interrupted = 1 };
+
+	until ($interrupted || $cancel->() || !$select->count) {
+		foreach my $fh ($select->can_read(0.25)) {
+			# stop following a log once its tail exits
+			unless (sysread($fh, $buffers{$fh}, 8192, length $buffers{$fh})) {
+				$select->remove($fh);
+				close $fh;
+				next;
+			}
+
+			while ($buffers{$fh} =~ s/^([^\n]*\n)//) {
+				my $line = $1;
+
+				# logs are chronological, so once a line was logged
+				# after the cutoff, all the following ones were too
+				unless ($started{$fh}) {
+					my $time = $self->decode_tai64n($line);
+					next unless defined $time && $time >= $cutoff;
+					$started{$fh} = 1;
+				}
+
+				print $out $names{$fh}, $options->{human_time} ? $self->humanize_tai64n($line) : $line;
+			}
+		}
+	}
+
+	kill 'TERM', @pids;
+	close $_ foreach $select->handles;
+}
+
+=head2 cached_status()
+
+Returns the L<statuses> attribute if it was read by C<status()> less than
+L<status_ttl> seconds ago, or L<kept|/"keep_status()"> (and not
+L<refreshed|/"refresh()"> since), and calls C<status()> otherwise. Cheap enough
+to call repeatedly, e.g. on every completion.
+
+=cut
+
+sub cached_status {
+	my $self = shift;
+
+	my $read_at = $self->_status_read_at;
+	return $self->status
+		unless defined $read_at && $self->status_ttl;
+
+	return $self->_status_kept || Time::HiRes::time() - $read_at < $self->status_ttl ?
+		$self->statuses :
+		$self->status;
+}
+
+=head2 keep_status()
+
+Keeps the statuses last read by C<status()> for
+L<cached_status()|/"cached_status()"> until they are L<refreshed|/"refresh()">,
+however old they get (unless L<status_ttl> is C<0>). The shell keeps the
+statuses it reads on start, so that the first completion is instant.
+
+=cut
+
+sub keep_status { shift->_status_kept(1) }
+
+=head2 refresh()
+
+Invalidates the statuses cached for L<cached_status()|/"cached_status()">, so
+that they are read again on the next call, e.g. after services were started
+or stopped.
+
+=cut
+
+sub refresh {
+	my $self = shift;
+
+	$self->_status_kept(0);
+	$self->_clear_status_read_at;
+}
+
+=head2 native_wait( $command )
+
+Returns a true value if the adapter can wait for the C<start>, C<stop> or
+C<restart> C<$command> to take effect by itself (when called with the C<wait>
+parameter). Returns false by default, in which case callers should use
+L<wait_for()|/"wait_for( $state, $timeout, @services, [ \%options ] )">.
+
+=cut
+
+sub native_wait { 0 }
+
+=head2 wait_for( $state, $timeout, @services, [ \%options ] )
+
+Polls the status of the services until all of them are in the C<$state>
+state (C<up> or C<down>), or until C<$timeout> seconds have passed. If the
+C<since> option is provided (a hash-ref of services and their process IDs),
+services are only considered C<up> once their process ID has changed, which
+allows waiting for restarts. The C<interval> option sets how many seconds to
+sleep between two polls (0.5 by default). Returns the list of services which
+did not reach the state in time.
+
+=cut
+
+sub wait_for {
+	my ($self, $state, $timeout, @services) = @_;
+
+	my $options = scalar @services && ref $services[-1] ? pop @services : {};
+	my $since = $options->{since} || {};
+	my $interval = $options->{interval} || 0.5;
+
+	my $deadline = Time::HiRes::time() + $timeout;
+	while (1) {
+		my $statuses = $self->status;
+
+		@services = grep {
+			my $s = $statuses->{$_};
+			!($s && $s->{status} eq $state && !($state eq 'up' && defined $since->{$_} && $s->{pid} eq $since->{$_}))
+		} @services;
+
+		last if !scalar @services || Time::HiRes::time() >= $deadline;
+
+		Time::HiRes::sleep($interval);
+	}
+
+	return @services;
+}
+
+=head2 stop_wait( $term, $timeout, @services )
+
+Stops the services and waits up to C<$timeout> seconds for them to go down.
+Services still up when the timeout expires are killed with
+L<force_stop()|/"force_stop( @services )"> (if the adapter supports it), and
+given another C<$KILL_TIMEOUT> seconds (5 by default) to go down. Returns the
+output of the supervisor commands, and dies with the list of services that
+refused to stop.
+
+=cut
+
+our $KILL_TIMEOUT = 5;
+
+sub stop_wait {
+	my ($self, $term, $timeout, @services) = @_;
+
+	my $native = $self->native_wait('stop');
+	my $output = $self->stop($term, { args => \@services, $native ? (wait => $timeout) : () });
+
+	my @laggards = $self->wait_for('down', $native ? 0 : $timeout, @services);
+
+	if (scalar @laggards && $self->can('force_stop')) {
+		$output .= $self->force_stop($term, { args => [@laggards] });
+		@laggards = $self->wait_for('down', $KILL_TIMEOUT, @laggards);
+	}
+
+	die "Services refused to stop: ".join(', ', @laggards)."\n"
+		if scalar @laggards;
+
+	return $output;
+}
+
+=head2 control( $char, @services )
+
+Writes a raw control character to the F<supervise/control> FIFO of a list of
+services, bypassing the suite's control tool, e.g. for commands it doesn't
+expose. Only suites whose supervisor reads such a FIFO (C<runit>, C<s6> and
+C<daemontools>) support it, and they declare the characters it understands in
+the C<@CONTROLS> package variable of their adapter class; dies listing them
+if C<$char> isn't one of them. Returns a message for every service whose FIFO
+couldn't be written to (e.g. because it isn't supervised). Not supported on
+remote hosts.
+
+=cut
+
+sub control {
+	my ($self, $char, @services) = @_;
+
+	my @controls = do {
+		no strict 'refs';
+		@{(ref $self).'::CONTROLS'};
+	};
+
+	die ref($self)." does not support the control command\n"
+		unless scalar @controls;
+	die "Unknown control character ".(defined $char ? $char : '').", valid characters are: ".join(' ', @controls)."\n"
+		unless defined $char && grep { $_ eq $char } @controls;
+	die "Control characters can't be written on remote hosts\n"
+		if $self->host;
+
+	my @messages;
+	foreach (@services) {
+		my $fifo = $self->basedir."/$_/supervise/control";
+
+		if ($self->dry_run) {
+			push(@messages, "Would write $char to $fifo\n");
+			next;
+		}
+
+		# opening the FIFO would block if no supervisor reads it
+		my $fh;
+		unless (sysopen($fh, $fifo, POSIX::O_WRONLY() | POSIX::O_NONBLOCK())) {
+			push(@messages, "Can't write to the control FIFO of $_ (is it supervised?): $!\n");
+			next;
+		}
+		push(@messages, "Can't write to the control FIFO of $_: $!\n")
+			unless syswrite($fh, $char);
+		close $fh;
+	}
+
+	return join('', @messages);
+}
+
+=head2 humanize_duration( $seconds )
+
+Formats a duration in seconds for humans, with its two most significant
+units: seconds are kept for durations shorter than an hour (e.g. C<45s> or
+C<12m3s>), so flapping services still read clearly, while long uptimes are
+shortened (e.g. C<5h12m>, C<3d4h> or C<2w1d>).
+
+=cut
+
+sub humanize_duration {
+	my ($self, $seconds) = @_;
+
+	$seconds = int($seconds || 0);
+
+	my @units = ([w => 604800], [d => 86400], [h => 3600], [m => 60], [s => 1]);
+	shift @units while scalar @units > 1 && $seconds < $units[0]->[1];
+
+	my ($major, $minor) = @units;
+	my $duration = int($seconds / $major->[1]).$major->[0];
+	my $rest = $minor ? int(($seconds % $major->[1]) / $minor->[1]) : 0;
+
+	return $rest ? $duration.$rest.$minor->[0] : $duration;
+}
+
+=head2 parse_duration( $duration )
+
+The reverse of L<humanize_duration()|/"humanize_duration( $seconds )">: returns
+the number of seconds of a duration such as C<90>, C<45s>, C<10m> or C<1h30m>
+(with C<w>, C<d>, C<h>, C<m> and C<s> units, in that order), or C<undef> if it
+isn't one.
+
+=cut
+
+sub parse_duration {
+	my ($self, $duration) = @_;
+
+	return unless defined $duration;
+	return $duration if $duration =~ m/^\d+$/;
+
+	my %units = (w => 604800, d => 86400, h => 3600, m => 60, s => 1);
+	return unless length $duration && $duration =~ m/^(?:\d+w)?(?:\d+d)?(?:\d+h)?(?:\d+m)?(?:\d+s)?$/;
+
+	my $seconds = 0;
+	$seconds += $1 * $units{$2} while $duration =~ m/(\d+)([wdhms])/g;
+	return $seconds;
+}
+
+=head2 decode_tai64n( $label )
+
+Returns the time (in seconds since the epoch, with fractions) of a TAI64N
+label, such as those prefixing lines logged by C<svlogd -t> and C<s6-log t>
+(e.g. C<@400000005f5e1a2b0c65d3a8>), or C<undef> if the string doesn't start
+with one. Leap seconds are ignored, as by most TAI64N writers.
+
+=cut
+
+sub decode_tai64n {
+	my ($self, $label) = @_;
+
+	return unless defined $label && $label =~ m/^\@([0-9a-f]{8})([0-9a-f]{8})([0-9a-f]{8})/i;
+
+	# labels count seconds from 2^62, 10 seconds before the epoch
+	return (hex($1) - 0x40000000) * 4294967296 + hex($2) - 10 + hex($3) / 1e9;
+}
+
+=head2 humanize_tai64n( $line )
+
+Replaces the TAI64N label a log line starts with (see
+L<decode_tai64n()|/"decode_tai64n( $label )">) with the local time it
+stands for, to the millisecond (e.g. C<2020-09-13 14:26:19.208>). Lines
+that don't start with a label are returned unchanged.
+
+=cut
+
+sub humanize_tai64n {
+	my ($self, $line) = @_;
+
+	my $time = $self->decode_tai64n($line);
+	return $line unless defined $time;
+
+	my $human = POSIX::strftime('%Y-%m-%d %H:%M:%S', localtime int($time)).
+		sprintf('.%03d', ($time - int($time)) * 1000);
+	$line =~ s/^\@[0-9a-f]{24}/$human/i;
+	return $line;
+}
+
+=head2 collapse_statuses( \%statuses )
+
+Collapses the statuses of multi-process services (see L<collapse|svsh/"COLLAPSE">),
+i.e. services whose names only differ by a dash and a numeric suffix (e.g.
+C<worker-1>, C<worker-2>), into one status under the common name (e.g.
+C<worker>), with the number of members in every state (e.g. C<2 up, 1 down>)
+and the longest duration. Returns a new hash-ref of statuses; other services
+are left as they are.
+
+=cut
+
+sub collapse_statuses {
+	my ($self, $statuses) = @_;
+
+	my %collapsed = %$statuses;
+
+	my %groups;
+	foreach my $sv (keys %collapsed) {
+		next unless $sv =~ m/^(.+)-\d+$/;
+		push(@{$groups{$1}}, delete $collapsed{$sv});
+	}
+
+	foreach my $sv (keys %groups) {
+		my $status_counters = {};
+		my $duration = 0;
+		foreach my $proc (@{$groups{$sv}}) {
+			$status_counters->{$proc->{status}} += 1;
+			$duration = $proc->{duration}
+				if $proc->{duration} > $duration;
+		}
+		$collapsed{$sv} = {
+			status => join(', ', map($status_counters->{$_}.' '.$_, sort(keys(%$status_counters)))),
+			pid => '-',
+			supervise_pid => '-',
+			duration => $duration
+		};
+	}
+
+	return \%collapsed;
+}
+
+=head2 expand_wildcards( @services )
+
+Goes over a list of services, possibly (but not necessarily)
+with wildcards, and returns a new (sorted) list with all services
+that match. For example, if C<@services = ('sv1', 'sv2', 'worker*')>,
+and the services C<worker-1> and C<worker-2> exist, then the
+method will return C<('sv1', 'sv2', 'worker-1', 'worker-2')>.
+Wildcards are C<*> (any number of characters) and C<?> (exactly one
+character), and dies if a wildcard matches no service, so typos don't
+silently operate on nothing.
+
+Numbered ranges are expanded too: C<worker[1-3]> expands to
+C<worker-1>, C<worker-2> and C<worker-3> (or C<worker1>, C<worker2>
+and C<worker3>, depending on which services exist). Leading zeros
+are kept, so C<worker[01-03]> expands to C<worker-01> and so on.
+Dies if a member of a range does not exist.
+
+Groups of services (see L<groups>) are replaced with their members,
+e.g. C<@frontend> with C<web> and C<api>. Dies if a group does not exist.
+
+Services outside the scope of the L<only> and L<exclude> attributes are
+left out, even if named explicitly.
+
+=cut
+
+sub expand_wildcards {
+	my $self = shift;
+
+	my @services = map {
+		my $group = m/^\@(.+)$/ ? $1 : undef;
+		die "No such group $group\n"
+			if defined $group && !$self->groups->{$group};
+		defined $group ? @{$self->groups->{$group}} : $_
+	} @_;
+
+	my %services;
+	foreach (@services) {
+		if (m/^(.*)\[(\d+)-(\d+)\](.*)$/) {
+			# this is a range, generate its members
+			foreach my $sv ($self->_expand_range($1, $2, $3, $4)) {
+				$services{$sv} = 1;
+			}
+		} elsif (m/[*?]/) {
+			# this is a wildcard, find all services that match it
+			my $regex = _glob_regex($_);
+			my @matches = grep { m/$regex/ } keys %{$self->statuses};
+			die "No services match $_\n"
+				unless scalar @matches;
+			$services{$_} = 1 foreach @matches;
+		} else {
+			$services{$_} = 1;
+		}
+	}
+
+	return sort grep { $self->in_scope($_) } keys %services;
+}
+
+=head2 in_scope( $service )
+
+Returns a true value if a service matches the L<only> pattern (if set) and
+doesn't match the L<exclude> pattern (if set), i.e. if the shell may see and
+act on it.
+
+=cut
+
+sub in_scope {
+	my ($self, $service) = @_;
+
+	return 0 if defined $self->only && $service !~ _glob_regex($self->only);
+	return 0 if defined $self->exclude && $service =~ _glob_regex($self->exclude);
+	return 1;
+}
+
+######################################################################
+# _glob_regex( $pattern )
+# returns a regular expression matching the names of services that
+# match a wildcard pattern, where * is any number of characters and
+# ? is exactly one
+######################################################################
+
+sub _glob_regex {
+	my $regex = join('', map { $_ eq '*' ? '.*' : $_ eq '?' ? '.' : quotemeta } split(/([*?])/, shift, -1));
+	return qr/^$regex$/;
+}
+
+######################################################################
+# _expand_range( $prefix, $from, $to, $suffix )
+# returns the names of the services of a numbered range, e.g.
+# ('worker-1', 'worker-2') for ('worker', 1, 2, ''), supporting both
+# "worker-1" and "worker1" naming, and dying if a member doesn't exist
+######################################################################
+
+sub _expand_range {
+	my ($self, $prefix, $from, $to, $suffix) = @_;
+
+	my $statuses = $self->statuses;
+	my $width = $from =~ m/^0/ ? length $from : 0;
+
+	my @services;
+	foreach my $n ($from <= $to ? $from .. $to : reverse($to .. $from)) {
+		my $num = sprintf('%0*d', $width, $n);
+		my ($sv) = grep { exists $statuses->{$_} } ("$prefix-$num$suffix", "$prefix$num$suffix");
+		die "Service $prefix-$num$suffix (from range $prefix\[$from-$to\]$suffix) does not exist\n"
+			unless $sv;
+		push(@services, $sv);
+	}
+
+	return @services;
+}
+
+######################################################################
+# _flag_statuses( \%statuses )
+# adds what the role knows about services to their statuses: the pid
+# of their supervising process in wide mode, and whether another
+# service reports the same process
+######################################################################
+
+sub _flag_statuses {
+	my ($self, $statuses) = @_;
+
+	if ($self->wide) {
+		my $supervisors = $self->_supervise_pids;
+		foreach (keys %$statuses) {
+			$statuses->{$_}->{supervise_pid} = $supervisors->{$_} || '-';
+		}
+	}
+
+	# two services can't be the same process, flag those that are
+	my %services_by_pid;
+	foreach (grep { $statuses->{$_}->{pid} =~ m/^\d+$/ && $statuses->{$_}->{pid} } keys %$statuses) {
+		push(@{$services_by_pid{$statuses->{$_}->{pid}}}, $_);
+	}
+	foreach my $services (grep { scalar @$_ > 1 } values %services_by_pid) {
+		$statuses->{$_}->{duplicate_pid} = 1 foreach @$services;
+	}
+
+	return $statuses;
+}
+
+######################################################################
+# _down_files( $create, @services )
+# creates (if $create is true) or removes the "down" file of a list
+# of services. supervisors of the daemontools family don't start
+# services with a down file, so this persistently disables or
+# enables them. works on remote hosts too
+######################################################################
+
+sub _down_files {
+	my ($self, $create, @services) = @_;
+
+	my @files = map { $self->basedir.'/'.$_.'/down' } @services;
+
+	return $create ?
+		$self->run_cmd('touch', @files) :
+		$self->run_cmd('rm', '-f', @files);
+}
+
+######################################################################
+# _signals()
+# returns a hash-ref of the signals supported by the adapter (see
+# the %SIGNALS package variable of adapter classes)
+######################################################################
+
+sub _signals {
+	my $class = ref $_[0] || $_[0];
+
+	no strict 'refs';
+	return \%{"${class}::SIGNALS"};
+}
+
+######################################################################
+# _translate_signal( $signal )
+# translates the name of a signal (case insensitive, with or without
+# the SIG prefix) to the argument of the supervisor's tool sending
+# it, dying if the adapter does not support the signal
+######################################################################
+
+sub _translate_signal {
+	my ($self, $signal) = @_;
+
+	my $name = uc($signal);
+	$name =~ s/^SIG//;
+
+	my $signals = $self->_signals;
+
+	die sprintf("%s does not support the SIG%s signal (supported signals: %s)\n",
+		$self->name, $name, join(', ', sort keys %$signals))
+			unless exists $signals->{$name};
+
+	return $signals->{$name};
+}
+
+######################################################################
+# _signal_number( $signal )
+# returns the number of a signal given by name (without the SIG
+# prefix), by number, or as an offset of a real-time signal (e.g.
+# RTMIN+3 or RTMAX-1); returns nothing if the system doesn't know it
+######################################################################
+
+sub _signal_number {
+	my ($self, $signal) = @_;
+
+	my %numbers;
+	@numbers{split(/ /, $Config{sig_name})} = split(/ /, $Config{sig_num});
+	my %names = reverse %numbers;
+
+	my $number;
+	if ($signal =~ m/^\d+$/) {
+		$number = $signal;
+	} elsif ($signal =~ m/^(RTMIN|RTMAX)(?:([+-])(\d+))?$/ && exists $numbers{RTMIN}) {
+		$number = $numbers{$1} + ($2 ? "$2$3" : 0);
+		return unless $number >= $numbers{RTMIN} && $number <= $numbers{RTMAX};
+	} elsif ($signal !~ m/^NUM/) {
+		$number = $numbers{$signal};
+	}
+
+	return unless $number && exists $names{$number};
+
+	return $number;
+}
+
+######################################################################
+# _kill( $number, @services )
+# sends a signal directly to the processes of a list of services,
+# returning a message for every service that couldn't be signalled
+######################################################################
+
+sub _kill {
+	my ($self, $number, @svcs) = @_;
+
+	my @messages;
+	foreach (@svcs) {
+		my $pid = $self->status_of($_)->{pid};
+
+		unless ($pid =~ m/^\d+$/ && $pid) {
+			push(@messages, "$_ is not running\n");
+			next;
+		}
+
+		if ($self->host || $self->dry_run) {
+			my $output = $self->run_cmd('kill', "-$number", $pid);
+			push(@messages, $output) if length $output;
+		} elsif (!kill($number, $pid)) {
+			push(@messages, "Can't signal $_ (pid $pid): $!\n");
+		}
+	}
+
+	return join('', @messages);
+}
+
+######################################################################
+# _want( $status, $raw )
+# returns the state the supervisor wants a service to be in: the
+# status tools of the daemontools family only say so ("want up" or
+# "want down") when it differs from the current status
+######################################################################
+
+sub _want {
+	my ($self, $status, $raw) = @_;
+
+	return $1 if $raw =~ m/want (up|down)/;
+	return $status =~ m/^(up|down)$/ ? $status : '-';
+}
+
+######################################################################
+# _unparsed_status( $raw )
+# returns the status hash-ref of a service whose status output
+# could not be parsed, so that it is still listed (as unknown)
+# rather than silently disappearing
+######################################################################
+
+sub _unparsed_status {
+	my ($self, $raw) = @_;
+
+	my $status = {
+		status => 'unknown',
+		duration => 0,
+		pid => '-',
+		parse_error => 1
+	};
+
+	$status->{raw} = $raw
+		if $self->debug;
+
+	return $status;
+}
+
+##############################################################
+# _resolve_cmd( $cmd )
+# returns the path to execute for $cmd, prefixing it with the
+# bindir attribute if it's one of the suite's tools, or dies
+# if the program can't be found
+##############################################################
+
+sub _resolve_cmd {
+	my ($self, $cmd) = @_;
+
+	my $suite_tool = $cmd =~ m/^(perp|s6|sv)/;
+
+	$cmd = $self->bindir . '/' . $cmd
+		if $self->bindir && $suite_tool;
+
+	# fail early with a helpful message if the program is missing,
+	# rather than returning the same error for every service
+	unless ($self->host || $self->runner || $self->_which($cmd)) {
+		my $suite = $self->name;
+		die $suite_tool ?
+			"The $suite control tool '$cmd' was not found; install $suite or set --bindir\n" :
+			"The '$cmd' program was not found in PATH\n";
+	}
+
+	return $cmd;
+}
+
+##############################################################
+# _capture( $cmd, @args )
+# returns a file handle from which the output of a command
+# can be read, running the command with the runner attribute
+# if provided, or starting it with _spawn() otherwise
+##############################################################
+
+sub _capture {
+	my ($self, $cmd, @args) = @_;
+
+	return $self->_spawn($cmd, @args)
+		unless $self->runner || !$self->_executes($cmd, @args);
+
+	my $output = $self->_executes($cmd, @args) ?
+		$self->runner->($cmd, @args) :
+		$self->_would_run($cmd, @args);
+	$output = '' unless defined $output;
+
+	open(my $fh, '<', \$output) || die "Can't read the output of $cmd: $!";
+	return $fh;
+}
+
+##############################################################
+# _trace( $cmd, \@args, $output )
+# passes a line describing a command that was run, with the
+# exit status it left in $?, to the logger attribute (only in
+# debug mode, which can be toggled at any time)
+##############################################################
+
+sub _trace {
+	my ($self, $cmd, $args, $output) = @_;
+
+	return unless $self->logger && $self->debug;
+
+	my $status = $? >> 8;
+
+	$output = '' unless defined $output;
+	$output =~ s/\s+/ /g;
+	$output =~ s/^ | $//g;
+	$output = substr($output, 0, 197).'...'
+		if length $output > 200;
+
+	$self->logger->(sprintf("%s (exit %d): %s\n", $self->_quote_command($cmd, @$args), $status, $output));
+}
+
+##############################################################
+# _executes( $cmd, @args )
+# returns a true value if a command should be executed, i.e.
+# unless in dry-run mode, where only commands querying the
+# supervisor (see the @QUERIES package variable of adapter
+# classes) and the programs inspecting the system are run
+##############################################################
+
+our @QUERIES = qw/tail cat readlink ls lsof find ps/;
+
+sub _executes {
+	my ($self, $cmd, @args) = @_;
+
+	return 1 unless $self->dry_run;
+
+	my @queries = do {
+		no strict 'refs';
+		(@QUERIES, @{(ref $self || $self).'::QUERIES'});
+	};
+
+	my $line = join(' ', (File::Spec->splitpath($cmd))[2], @args);
+	return scalar grep { $line eq $_ || index($line, "$_ ") == 0 } @queries;
+}
+
+##############################################################
+# _would_run( $cmd, @args )
+# returns the line printed in dry-run mode instead of running
+# a command, which is quoted, so it can be copied and run
+##############################################################
+
+sub _would_run {
+	my ($self, $cmd, @args) = @_;
+
+	return 'Would run: '.$self->_quote_command($cmd, @args)."\n";
+}
+
+##############################################################
+# _quote_command( $cmd, @args )
+# returns the command line executed to run $cmd with @args
+# (see _command_line()), with the arguments sh would split or
+# expand quoted, for dry-run and debug output
+##############################################################
+
+sub _quote_command {
+	my ($self, $cmd, @args) = @_;
+
+	return join(' ', map {
+		m/^[\w\/.,:=+@%-]+$/ ? $_ : _sh_quote($_)
+	} $self->_command_line($cmd, @args));
+}
+
+##############################################################
+# _sh_quote( $arg )
+# quotes an argument for sh, in single quotes (in which only
+# single quotes themselves need escaping)
+##############################################################
+
+sub _sh_quote {
+	(my $arg = shift) =~ s/'/'\\''/g;
+	return "'$arg'";
+}
+
+##############################################################
+# _signal_pids( $signal, @pids )
+# sends a signal to processes of the local machine, or returns
+# the kill command that would send it in dry-run mode
+##############################################################
+
+sub _signal_pids {
+	my ($self, $signal, @pids) = @_;
+
+	return $self->_would_run('kill', "-$signal", @pids)
+		if $self->dry_run;
+
+	kill $signal, @pids;
+	return '';
+}
+
+##############################################################
+# _spawn( $cmd, @args )
+# starts a command and returns a file handle from which its
+# output (standard output and error combined) can be read
+##############################################################
+
+sub _spawn {
+	my ($self, $cmd, @args) = @_;
+
+	# run the command directly rather than through the shell,
+	# so arguments (e.g. service names with spaces) are passed
+	# as-is, and capture both standard output and error. the C
+	# locale makes sure tools don't translate their output
+	my @command = $self->_command_line($cmd, @args);
+
+	my $pid = open(my $fh, '-|') // die "Can't fork: $!";
+	unless ($pid) {
+		$ENV{LC_ALL} = 'C';
+		open(STDERR, '>&', \*STDOUT);
+		# don't run the parent's END blocks and destructors if the
+		# command can't be executed
+		exec { $command[0] } @command
+			or print STDERR "Can't exec $command[0]: $!\n";
+		POSIX::_exit(127);
+	}
+
+	return wantarray ? ($fh, $pid) : $fh;
+}
+
+##############################################################
+# _command_line( $cmd, @args )
+# returns the command line to execute $cmd with @args, which
+# is the command itself, or an ssh command line running it on
+# the host attribute. the remote shell splits the command it
+# receives, so every argument is quoted
+##############################################################
+
+sub _command_line {
+	my ($self, $cmd, @args) = @_;
+
+	return ($cmd, @args)
+		unless $self->host;
+
+	my $remote = join(' ', 'LC_ALL=C', map { _sh_quote($_) } $cmd, @args);
+
+	return ('ssh', '-n', $self->host, '--', $remote);
+}
+
+##############################################################
+# _readlink( $path ) / _readdir( $dir )
+# read a symbolic link, or the entries of a directory (except
+# for . and ..), on the supervisor's host
+##############################################################
+
+sub _readlink {
+	my ($self, $path) = @_;
+
+	return readlink($path)
+		unless $self->host;
+
+	my $target = $self->run_cmd('readlink', $path);
+	chomp($target);
+
+	return length $target ? $target : undef;
+}
+
+sub _readdir {
+	my ($self, $dir) = @_;
+
+	unless ($self->host) {
+		opendir(my $dh, $dir) || return;
+		my @entries = grep { !/^\.\.?$/ } readdir $dh;
+		closedir $dh;
+		return @entries;
+	}
+
+	return grep { !/^\.\.?$/ } map { chomp; $_ } $self->run_cmd('ls', '-a', $dir);
+}
+
+##############################################################
+# _has_proc()
+# returns a true value if the supervisor's host has a /proc
+# file system
+##############################################################
+
+sub _has_proc {
+	my $self = shift;
+
+	return -d '/proc/self'
+		unless $self->host;
+
+	my $output = $self->run_cmd('ls', '-d', '/proc/self');
+	chomp($output);
+
+	return $output eq '/proc/self';
+}
+
+##############################################################
+# _proc_files( $pid ) / _lsof_files( $pid )
+# return the executable of a process, followed by the files
+# it has open, read either from /proc or from lsof's output
+##############################################################
+
+sub _proc_files {
+	my ($self, $pid) = @_;
+
+	my $exe = $self->_readlink("/proc/$pid/exe")
+		|| return;
+
+	return ($exe, grep { defined } map { $self->_readlink("/proc/$pid/fd/$_") } $self->_readdir("/proc/$pid/fd"));
+}
+
+sub _lsof_files {
+	my ($self, $pid) = @_;
+
+	# with -F, lsof prints one field per line: "f" lines hold
+	# a file descriptor (or "txt" for the program's text), and
+	# the "n" lines that follow them hold the file's name
+	my ($fd, $exe, @files) = ('');
+	foreach ($self->run_cmd('lsof', '-n', '-P', '-p', $pid, '-F', 'fn')) {
+		chomp;
+		if (m/^f(.*)$/) {
+			$fd = $1;
+		} elsif (m/^n(.*)$/) {
+			my $name = $1;
+			if ($fd eq 'txt') {
+				$exe = $name unless defined $exe;
+			} elsif ($fd =~ m/^\d+/) {
+				push(@files, $name);
+			}
+		}
+	}
+
+	return unless defined $exe;
+
+	return ($exe, @files);
+}
+
+##############################################################
+# _slurp( $fh )
+# reads everything from a file handle returned by _spawn(),
+# and closes it, leaving the exit status of the command in $?
+##############################################################
+
+sub _slurp {
+	my $fh = shift;
+
+	my $output = do { local $/; <$fh> };
+	$? = 0 if close $fh;
+
+	return defined $output ? $output : '';
+}
+
+#########################################################
+# _which( $cmd )
+# returns the full path of a command, searching the PATH
+# environment variable unless the command already has
+# a path; returns nothing if the command isn't found
+#########################################################
+
+sub _which {
+	my ($self, $cmd) = @_;
+
+	if ($cmd =~ m!/!) {
+		return -f $cmd && -x _ ? $cmd : undef;
+	}
+
+	foreach (File::Spec->path) {
+		return "$_/$cmd" if -f "$_/$cmd" && -x _;
+	}
+
+	return;
+}
+
+#########################################################
+# _processes()
+# returns a list of all running processes (as found under
+# /proc), each a hash-ref with the process ID (pid), its
+# command line arguments (argv) and its working directory
+# (cwd, if it can be read)
+#########################################################
+
+sub _processes {
+	my $self = shift;
+
+	die "Inspecting the processes of a remote host is not supported\n"
+		if $self->host;
+
+	my @procs;
+
+	opendir(my $dh, '/proc') || return;
+	foreach my $pid (grep { m/^\d+$/ } readdir $dh) {
+		open(my $fh, '<', "/proc/$pid/cmdline") || next;
+		my $cmdline = do { local $/; <$fh> };
+		close $fh;
+
+		next unless defined $cmdline && length $cmdline;
+
+		push(@procs, {
+			pid => $pid,
+			argv => [split(/\0/, $cmdline)],
+			cwd => readlink("/proc/$pid/cwd")
+		});
+	}
+	closedir $dh;
+
+	return @procs;
+}
+
+#########################################################
+# _supervise_pids()
+# returns a hash-ref of service names and the process IDs
+# of the processes supervising them (runsv, s6-supervise
+# or supervise), found by matching the service name and
+# working directory of these processes against the base
+# directory
+#########################################################
+
+sub _supervise_pids {
+	my $self = shift;
+
+	my $basedir = Cwd::abs_path($self->basedir) || $self->basedir;
+
+	my $pids = {};
+	foreach my $proc ($self->_processes) {
+		my ($prog, $name) = @{$proc->{argv}};
+		next unless $prog && defined $name && $prog =~ m!(^|/)(runsv|s6-supervise|supervise)$!;
+
+		$pids->{$name} = $proc->{pid}
+			if defined $proc->{cwd} && $proc->{cwd} eq $basedir;
+	}
+
+	return $pids;
+}
+
+######################################################################
+# _supervisor_pid( @processes )
+# returns the ID of the process in @processes (as returned by the
+# _processes() method) supervising the base directory, or dies if
+# there isn't one
+######################################################################
+
+sub _supervisor_pid {
+	my ($self, @processes) = @_;
+
+	my ($pid) = $self->_supervisor_pids(Cwd::abs_path($self->basedir) || $self->basedir, @processes)
+		or die "Can't find the supervisor process of ".$self->basedir;
+
+	return $pid;
+}
+
+######################################################################
+# _supervisor_pids( $dir, @processes )
+# returns the IDs of all processes in @processes (as returned by the
+# _processes() method) whose command line is that of the supervisor
+# (as named by the $SUPERVISOR package variable of the adapter class,
+# e.g. "runsvdir"), supervising exactly the directory $dir. The
+# directory is either one of the supervisor's arguments, or its
+# working directory if none of the arguments is a path
+######################################################################
+
+sub _supervisor_pids {
+	my ($self, $dir, @processes) = @_;
+
+	my $supervisor = do {
+		no strict 'refs';
+		${(ref $self || $self).'::SUPERVISOR'};
+	} || return;
+
+	$dir = File::Spec->canonpath($dir);
+
+	my @pids;
+	foreach my $proc (@processes) {
+		my ($prog, @args) = @{$proc->{argv}};
+		next unless $prog && (File::Spec->splitpath($prog))[2] eq $supervisor;
+
+		my @dirs = grep { !m/^-/ } @args;
+		@dirs = map { File::Spec->rel2abs($_, $proc->{cwd}) } @dirs
+			if defined $proc->{cwd};
+		push(@dirs, $proc->{cwd})
+			if defined $proc->{cwd} && !grep { m!/! } @args;
+
+		push(@pids, $proc->{pid})
+			if grep { File::Spec->canonpath($_) eq $dir } @dirs;
+	}
+
+	return @pids;
+}
+
+#########################################################
+# _has_service( $service )
+# returns a true value if a service exists in the base
+# directory
+#########################################################
+
+sub _has_service {
+	my ($self, $service) = @_;
+
+	return scalar grep { $_ eq $service } $self->_service_dirs
+		if $self->host;
+
+	return defined $service && length $service && -d $self->basedir.'/'.$service;
+}
+
+#########################################################
+# _service_dirs()
+# returns a list of all service directories inside the
+# base directory
+#########################################################
+
+sub _service_dirs {
+	my $self = shift;
+	my $basedir = $self->basedir;
+
+	# on remote hosts, let find list the (possibly linked) directories
+	if ($self->host) {
+		return sort grep { !/^\./ } map { chomp; s!^.*/!!; $_ }
+			$self->run_cmd('find', '-L', $basedir, '-mindepth', '1', '-maxdepth', '1', '-type', 'd');
+	}
 
 	opendir(my $dh, $basedir);
 	my @dirs = grep { !/^\./ && -d "$basedir/$_" } readdir $dh;
@@ -2,8 +2,29 @@ package Svsh::Daemontools;
 
 use Moo;
 use namespace::clean;
+use File::Spec;
 
 our $DEFAULT_BASEDIR = '/service';
+our $SUPERVISOR = 'svscan';
+our $CONTROL_TOOL = 'svstat';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = qw/svstat/;
+
+# signals supported by svc, and the options sending them
+our %SIGNALS = (
+	HUP => 'h',
+	INT => 'i',
+	KILL => 'k',
+	ALRM => 'a',
+	TERM => 't',
+	STOP => 'p',
+	CONT => 'c'
+);
+
+# control characters understood by supervise (see svc)
+our @CONTROLS = qw/u d o p c h a i t k x/;
 
 with 'Svsh';
 
@@ -32,20 +53,28 @@ the base specifications are listed here.
 
 sub status {
 	my $statuses = {};
-	foreach ($_[0]->_service_dirs) {
-		my $raw = $_[0]->run_cmd('svstat', $_[0]->basedir.'/'.$_);
 
-		my ($status, $pid, $duration) = $raw =~ m/$_: (\w+)(?: \(pid (\d+)\))? (\d+) seconds/;
+	# query all services in parallel
+	my @services = $_[0]->_service_dirs;
+	my @outputs = $_[0]->run_cmds(
+		(map { ['svstat', $_[0]->basedir.'/'.$_] } @services),
+		{ concurrency => $_[0]->status_concurrency }
+	);
+
+	$statuses->{$_} = $_[0]->_parse_status($_, shift @outputs)
+		foreach @services;
 
-		$statuses->{$_} = {
-			status => $status,
-			duration => $duration || 0,
-			pid => $pid || '-'
-		};
-	}
 	return $statuses;
 }
 
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	$_[0]->_parse_status($_[1], scalar $_[0]->run_cmd('svstat', $_[0]->basedir.'/'.$_[1]));
+}
+
 =head2 start( @services )
 
 =cut
@@ -62,6 +91,16 @@ sub stop {
 	$_[0]->run_cmd('svc', '-d', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
 }
 
+=head2 force_stop( @services )
+
+Sends C<svc -dk>, i.e. brings the services down and kills them.
+
+=cut
+
+sub force_stop {
+	$_[0]->run_cmd('svc', '-dk', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
 =head2 restart( @services )
 
 This is implemented by sending the C<TERM> signal to the services, as opposed to the
@@ -83,29 +122,111 @@ C<USR1>, C<USR2>, C<QUIT> and C<WINCH> are not supported by C<daemontools>.
 sub signal {
 	my ($sign, @sv) = @{$_[2]->{args}};
 
-	# convert signal to perpctl command
-	$sign =~ s/^sig//i;
-	die "daemontools does not support the $sign signal"
-		if lc($sign) =~ m/^(usr\d|quit|winch)$/;
+	$_[0]->run_cmd('svc', '-'.$_[0]->_translate_signal($sign), map { $_[0]->basedir.'/'.$_ } @sv);
+}
+
+=head2 once( @services )
+
+=cut
+
+sub once {
+	$_[0]->run_cmd('svc', '-o', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 enable( @services )
+
+Removes the C<down> file of the services.
+
+=cut
+
+sub enable {
+	$_[0]->_down_files(0, @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
 
-	$_[0]->run_cmd('svc', '-'.lc(substr($sign, 0, 1)), map { $_[0]->basedir.'/'.$_ } @sv);
+Creates a C<down> file in the directories of the services.
+
+=cut
+
+sub disable {
+	$_[0]->_down_files(1, @{$_[2]->{args}});
 }
 
-=head2 fg( $service )
+=head2 fg( @services )
 
 =cut
 
 sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
 	# find out the pid of the logging process
-	my $text = $_[0]->run_cmd('svstat', $_[0]->basedir.'/'.$_[2]->{args}->[0].'/log');
+	my $text = $self->run_cmd('svstat', $self->basedir.'/'.$service.'/log');
 	my $pid = ($text =~ m/up \(pid (\d+)\)/)[0]
-		|| die "Can't figure out pid of the logging process";
+		|| die "Can't figure out pid of the logging process of $service";
 
 	# find out the current log file
-	my $logfile = $_[0]->find_logfile($pid)
-		|| die "Can't find out process' log file";
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
+}
+
+=head2 terminate( [ $dir ] )
+
+C<svscan> does not stop its services when it is signaled, so this sends a
+C<TERM> signal to the C<svscan> process scanning the base directory (or the
+provided directory, relative paths being relative to the base directory),
+so that it does not restart them, and then stops all services (and their
+loggers) and their C<supervise> processes with C<svc -dx>.
+
+=cut
+
+sub terminate {
+	my $dir = $_[2] && $_[2]->{args} && $_[2]->{args}->[0];
+	$dir = $dir ? File::Spec->rel2abs($dir, $_[0]->basedir) : $_[0]->basedir;
+
+	my @pids = $_[0]->_supervisor_pids($dir, $_[0]->_processes)
+		or die "Can't find an svscan process scanning $dir";
+
+	my $output = $_[0]->_signal_pids('TERM', @pids);
+
+	opendir(my $dh, $dir) || die "Can't read $dir: $!";
+	my @services = map { -d "$dir/$_/log" ? ("$dir/$_", "$dir/$_/log") : "$dir/$_" }
+		grep { !/^\./ && -d "$dir/$_" } readdir $dh;
+	closedir $dh;
+
+	$output .= $_[0]->run_cmd('svc', '-dx', sort @services)
+		if scalar @services;
+
+	return $output;
+}
+
+##############################################################
+# _parse_status( $service, $output )
+# parses the output of svstat for a service
+##############################################################
+
+sub _parse_status {
+	my ($self, $service, $raw) = @_;
+
+	my ($status, $pid, $duration) = $raw =~ m/\Q$service\E: (\w+)(?: \(pid (\d+)\))? (\d+) seconds/;
+
+	return $self->_unparsed_status($raw)
+		unless $status;
 
-	$_[0]->run_cmd('tail', '-f', $logfile, { as_system => 1 });
+	return {
+		status => $status,
+		want => $self->_want($status, $raw),
+		duration => $duration || 0,
+		pid => $pid || '-'
+	};
 }
 
 =head1 BUGS AND LIMITATIONS
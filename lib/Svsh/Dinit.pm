@@ -0,0 +1,315 @@
+package Svsh::Dinit;
+
+use Moo;
+use namespace::clean;
+
+our $DEFAULT_BASEDIR = '/etc/dinit.d';
+our $SUPERVISOR = 'dinit';
+our $CONTROL_TOOL = 'dinitctl';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('dinitctl list', 'dinitctl --version');
+
+# the command printing the version of the suite
+our @VERSION_COMMAND = ('dinitctl', '--version');
+
+# signals sent with dinitctl signal, which takes their names
+our %SIGNALS = map { $_ => $_ } qw/HUP INT QUIT KILL USR1 USR2 ALRM TERM STOP CONT WINCH/;
+
+with 'Svsh';
+
+=head1 NAME
+
+Svsh::Dinit - dinit support for svsh
+
+=head1 DESCRIPTION
+
+This class provides support for L<dinit|https://davmac.org/projects/dinit/>
+to L<svsh> - the supervisor shell.
+
+Services are the services loaded by C<dinit>, and are controlled with C<dinitctl>.
+Services marked started (C<+>) in the listing of C<dinitctl list> are C<up>,
+services that are starting (C<<< << >>>) are in C<backoff>, and services that are
+stopped (C<->), stopping (C<<< >> >>>) or failed to start (C<X>) are C<down>.
+
+=head2 DEFAULT BASE DIRECTORY
+
+C<dinit> reads the descriptions of system services from C</etc/dinit.d>, which is
+the default base directory. Services are not directories, but files of this
+directory, and the base directory is only used to find their log files.
+
+=head1 IMPLEMENTED METHODS
+
+Refer to L<Svsh> for complete explanation of these methods. Only changes from
+the base specifications are listed here.
+
+=head2 status()
+
+The services are listed with their states by C<dinitctl list>, which doesn't
+tell how long services have been in their states, so durations are always 0.
+
+=cut
+
+sub status {
+	$_[0]->_parse_list(scalar $_[0]->run_cmd('dinitctl', 'list'));
+}
+
+=head2 start( @services )
+
+C<dinitctl> acts on one service at a time, and doesn't wait for it to start
+(C<--no-wait>); waiting is done by polling the status of the services. The
+same goes for C<stop> and C<restart>.
+
+=cut
+
+sub start {
+	$_[0]->_dinitctl('start', @{$_[2]->{args}});
+}
+
+=head2 stop( @services )
+
+=cut
+
+sub stop {
+	$_[0]->_dinitctl('stop', @{$_[2]->{args}});
+}
+
+=head2 restart( @services )
+
+=cut
+
+sub restart {
+	$_[0]->_dinitctl('restart', @{$_[2]->{args}});
+}
+
+=head2 signal( $signal, @services )
+
+Signals are sent to the processes of the services with C<dinitctl signal>.
+
+=cut
+
+sub signal {
+	my ($sign, @sv) = @{$_[2]->{args}};
+
+	my $signal = $_[0]->_translate_signal($sign);
+	join('', map { $_[0]->run_cmd('dinitctl', 'signal', $signal, $_) } @sv);
+}
+
+=head2 enable( @services )
+
+=cut
+
+sub enable {
+	join('', map { $_[0]->run_cmd('dinitctl', 'enable', $_) } @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+=cut
+
+sub disable {
+	join('', map { $_[0]->run_cmd('dinitctl', 'disable', $_) } @{$_[2]->{args}});
+}
+
+=head2 rescan()
+
+C<dinit> has no command to look for new services (they are loaded when first
+started), so this reloads the descriptions of all loaded services from their
+files with C<dinitctl reload>.
+
+=cut
+
+sub rescan {
+	join('', map { $_[0]->run_cmd('dinitctl', 'reload', $_) } $_[0]->_service_dirs);
+}
+
+=head2 terminate()
+
+Shuts the system down with C<dinitctl shutdown>, as C<dinit> is usually the
+init system, stopping all services. Nested supervision trees are not supported.
+
+=cut
+
+sub terminate {
+	$_[0]->run_cmd('dinitctl', 'shutdown');
+}
+
+=head2 fg( @services )
+
+=cut
+
+sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+C<dinit> itself writes the output of services to the file named by the C<logfile>
+setting of their description (in the base directory), so that file is returned.
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
+	my ($file) = $self->run_cmd('cat', $self->basedir.'/'.$service) =~ m/^\s*logfile\s*=\s*(.+?)\s*$/m;
+
+	return $file
+		|| die "Can't find out the log file of $service (it has no logfile setting)";
+}
+
+##############################################################
+# _service_dirs()
+# returns the names of all loaded services; there are no
+# service directories with dinit
+##############################################################
+
+sub _service_dirs {
+	sort keys %{$_[0]->_parse_list(scalar $_[0]->run_cmd('dinitctl', 'list'))};
+}
+
+##############################################################
+# _has_service( $service )
+# returns a true value if a service is loaded
+##############################################################
+
+sub _has_service {
+	my ($self, $service) = @_;
+
+	return defined $service && scalar grep { $_ eq $service } $self->_service_dirs;
+}
+
+##############################################################
+# _dinitctl( $command, @services )
+# runs a dinitctl command (without waiting for it to take
+# effect) for every one of the services, returning their
+# combined output
+##############################################################
+
+sub _dinitctl {
+	my ($self, $cmd, @services) = @_;
+
+	return join('', map { $self->run_cmd('dinitctl', '--no-wait', $cmd, $_) } @services);
+}
+
+##############################################################
+# _parse_list( $output )
+# parses the output of dinitctl list, with one service per
+# line, e.g.:
+# [{+}     ] sshd (pid: 1234)
+# the left box holds the state of started services, and the
+# right box that of stopped ones (braces mark services that
+# were explicitly activated), with << and >> in between for
+# services that are starting or stopping
+##############################################################
+
+sub _parse_list {
+	my ($self, $output) = @_;
+
+	my $statuses = {};
+	foreach my $line (split(/\n/, $output)) {
+		my ($started, $transition, $stopped, $service, $details) = $line =~ m/^\[.(.).(..).(.).\]\s+(\S+)(?:\s+\((.*)\))?\s*$/
+			or next;
+
+		my $status = $transition eq '<<' ? 'backoff' :
+			$transition eq '>>' ? 'down' :
+			$started eq '+' ? 'up' :
+			$stopped =~ m/^[-X]$/ ? 'down' : undef;
+
+		unless ($status) {
+			$statuses->{$service} = $self->_unparsed_status($line);
+			next;
+		}
+
+		my ($pid) = ($details || '') =~ m/pid: (\d+)/;
+
+		$statuses->{$service} = {
+			status => $status,
+			duration => 0,
+			pid => $pid || '-'
+		};
+	}
+
+	return $statuses;
+}
+
+=head1 BUGS AND LIMITATIONS
+
+No bugs have been reported.
+
+Please report any bugs or feature requests to
+C<bug-Svsh@rt.cpan.org>, or through the web interface at
+L<http://rt.cpan.org/NoAuth/ReportBug.html?Queue=Svsh>.
+
+=head1 SUPPORT
+
+You can find documentation for this module with the perldoc command.
+
+	perldoc Svsh::Dinit
+
+You can also look for information at:
+
+=over 4
+ 
+=item * RT: CPAN's request tracker
+ 
+L<http://rt.cpan.org/NoAuth/Bugs.html?Dist=Svsh>
+ 
+=item * AnnoCPAN: Annotated CPAN documentation
+ 
+L<http://annocpan.org/dist/Svsh>
+ 
+=item * CPAN Ratings
+ 
+L<http://cpanratings.perl.org/d/Svsh>
+ 
+=item * Search CPAN
+ 
+L<http://search.cpan.org/dist/Svsh/>
+ 
+=back
+
+=head1 AUTHOR
+
+Ido Perlmuter <ido at ido50 dot net>
+
+=head1 LICENSE AND COPYRIGHT
+
+Copyright (c) 2015, Ido Perlmuter C<< ido at ido50 dot net >>.
+
+This module is free software; you can redistribute it and/or
+modify it under the same terms as Perl itself, either version
+5.8.1 or any later version. See L<perlartistic|perlartistic> 
+and L<perlgpl|perlgpl>.
+
+The full text of the license can be found in the
+LICENSE file included with this module.
+
+=head1 DISCLAIMER OF WARRANTY
+
+BECAUSE THIS SOFTWARE IS LICENSED FREE OF CHARGE, THERE IS NO WARRANTY
+FOR THE SOFTWARE, TO THE EXTENT PERMITTED BY APPLICABLE LAW. EXCEPT WHEN
+OTHERWISE STATED IN WRITING THE COPYRIGHT HOLDERS AND/OR OTHER PARTIES
+PROVIDE THE SOFTWARE "AS IS" WITHOUT WARRANTY OF ANY KIND, EITHER
+EXPRESSED OR IMPLIED, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE. THE
+ENTIRE RISK AS TO THE QUALITY AND PERFORMANCE OF THE SOFTWARE IS WITH
+YOU. SHOULD THE SOFTWARE PROVE DEFECTIVE, YOU ASSUME THE COST OF ALL
+NECESSARY SERVICING, REPAIR, OR CORRECTION.
+
+IN NO EVENT UNLESS REQUIRED BY APPLICABLE LAW OR AGREED TO IN WRITING
+WILL ANY COPYRIGHT HOLDER, OR ANY OTHER PARTY WHO MAY MODIFY AND/OR
+REDISTRIBUTE THE SOFTWARE AS PERMITTED BY THE ABOVE LICENCE, BE
+LIABLE TO YOU FOR DAMAGES, INCLUDING ANY GENERAL, SPECIAL, INCIDENTAL,
+OR CONSEQUENTIAL DAMAGES ARISING OUT OF THE USE OR INABILITY TO USE
+THE SOFTWARE (INCLUDING BUT NOT LIMITED TO LOSS OF DATA OR DATA BEING
+RENDERED INACCURATE OR LOSSES SUSTAINED BY YOU OR THIRD PARTIES OR A
+FAILURE OF THE SOFTWARE TO OPERATE WITH ANY OTHER SOFTWARE), EVEN IF
+SUCH HOLDER OR OTHER PARTY HAS BEEN ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGES.
+
+=cut
+
+1;
+__END__
@@ -0,0 +1,293 @@
+package Svsh::Nosh;
+
+use Moo;
+use namespace::clean;
+
+our $DEFAULT_BASEDIR = '/var/sv';
+our $SUPERVISOR = 'service-manager';
+our $CONTROL_TOOL = 'system-control';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = qw/service-status/;
+
+# signals supported by service-control (which is compatible with
+# daemontools' svc), and the options sending them
+our %SIGNALS = (
+	HUP => 'h',
+	INT => 'i',
+	QUIT => 'q',
+	KILL => 'k',
+	ALRM => 'a',
+	TERM => 't',
+	STOP => 'p',
+	CONT => 'c',
+	USR1 => '1',
+	USR2 => '2',
+	WINCH => 'w'
+);
+
+# the states service-status reports, and the statuses they
+# translate to
+our %STATES = (
+	running => 'up',
+	ready => 'up',
+	started => 'up',
+	starting => 'backoff',
+	stopping => 'down',
+	stopped => 'down',
+	done => 'down',
+	failed => 'down'
+);
+
+with 'Svsh';
+
+=head1 NAME
+
+Svsh::Nosh - nosh support for svsh
+
+=head1 DESCRIPTION
+
+This class provides support for L<nosh|https://jdebp.uk/Softwares/nosh/>
+to L<svsh> - the supervisor shell.
+
+Services are controlled with C<system-control>, and their statuses are read
+with C<service-status>. C<running>, C<ready> and C<started> services are C<up>,
+C<starting> services and services which want to run but can't are in C<backoff>,
+services that are not present (not loaded into the service manager) are
+C<disabled>, and C<stopped>, C<stopping>, C<done> or C<failed> services are
+C<down>.
+
+=head2 DEFAULT BASE DIRECTORY
+
+C<nosh> keeps the bundles of local system services in C</var/sv>, which is the
+default base directory. Services of other bundle directories (e.g.
+C</etc/service-bundles/services>) can be managed by providing their directory.
+
+=head1 IMPLEMENTED METHODS
+
+Refer to L<Svsh> for complete explanation of these methods. Only changes from
+the base specifications are listed here.
+
+=head2 status()
+
+=cut
+
+sub status {
+	my $statuses = {};
+
+	# query all services in parallel
+	my @services = $_[0]->_service_dirs;
+	my @outputs = $_[0]->run_cmds(
+		(map { ['service-status', $_[0]->basedir.'/'.$_] } @services),
+		{ concurrency => $_[0]->status_concurrency }
+	);
+
+	$statuses->{$_} = $_[0]->_parse_status($_, shift @outputs)
+		foreach @services;
+
+	return $statuses;
+}
+
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	$_[0]->_parse_status($_[1], scalar $_[0]->run_cmd('service-status', $_[0]->basedir.'/'.$_[1]));
+}
+
+=head2 start( @services )
+
+=cut
+
+sub start {
+	$_[0]->run_cmd('system-control', 'start', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 stop( @services )
+
+=cut
+
+sub stop {
+	$_[0]->run_cmd('system-control', 'stop', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 restart( @services )
+
+=cut
+
+sub restart {
+	$_[0]->run_cmd('system-control', 'restart', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 signal( $signal, @services )
+
+C<system-control> has no generic command for sending signals, so signals
+are sent with C<service-control>, nosh's equivalent of C<svc>.
+
+=cut
+
+sub signal {
+	my ($sign, @sv) = @{$_[2]->{args}};
+
+	$_[0]->run_cmd('service-control', '-'.$_[0]->_translate_signal($sign), map { $_[0]->basedir.'/'.$_ } @sv);
+}
+
+=head2 enable( @services )
+
+=cut
+
+sub enable {
+	$_[0]->run_cmd('system-control', 'enable', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+=cut
+
+sub disable {
+	$_[0]->run_cmd('system-control', 'disable', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 fg( @services )
+
+=cut
+
+sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+The log service of a service is the C<log> service directory of its bundle,
+usually running C<cyclog>.
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
+	# find out the pid of the logging process
+	my $text = $self->run_cmd('service-status', $self->basedir.'/'.$service.'/log');
+	my $pid = ($text =~ m/\(pid (\d+)\)/)[0]
+		|| die "Can't figure out pid of the logging process of $service";
+
+	# find out the current log file
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
+}
+
+##############################################################
+# _parse_status( $service, $output )
+# parses the output of service-status for a service, e.g.:
+# /var/sv/ntpd: running (pid 1234) 1h 2m 3s ago
+##############################################################
+
+sub _parse_status {
+	my ($self, $service, $raw) = @_;
+
+	my ($state) = $raw =~ m/\Q$service\E: (.+)$/m
+		or return $self->_unparsed_status($raw);
+
+	my $status = $state =~ m/not present/ ? 'disabled' :
+		$state =~ m/wants? to run but can't/ ? 'backoff' :
+		$state =~ m/^(\w+)/ && $STATES{$1};
+
+	return $self->_unparsed_status($raw)
+		unless $status;
+
+	# durations are listed in several units, e.g. 1h 2m 3s ago
+	my %seconds = (w => 604800, d => 86400, h => 3600, m => 60, s => 1);
+	my ($since) = $state =~ m/((?:\d+[wdhms]\s*)+) ago/;
+	my $duration = 0;
+	$duration += $1 * $seconds{$2} while defined $since && $since =~ m/(\d+)([wdhms])/g;
+
+	my ($pid) = $state =~ m/\(pid (\d+)\)/;
+
+	return {
+		status => $status,
+		duration => $duration,
+		pid => $pid || '-'
+	};
+}
+
+=head1 BUGS AND LIMITATIONS
+
+No bugs have been reported.
+
+Please report any bugs or feature requests to
+C<bug-Svsh@rt.cpan.org>, or through the web interface at
+L<http://rt.cpan.org/NoAuth/ReportBug.html?Queue=Svsh>.
+
+=head1 SUPPORT
+
+You can find documentation for this module with the perldoc command.
+
+	perldoc Svsh::Nosh
+
+You can also look for information at:
+
+=over 4
+ 
+=item * RT: CPAN's request tracker
+ 
+L<http://rt.cpan.org/NoAuth/Bugs.html?Dist=Svsh>
+ 
+=item * AnnoCPAN: Annotated CPAN documentation
+ 
+L<http://annocpan.org/dist/Svsh>
+ 
+=item * CPAN Ratings
+ 
+L<http://cpanratings.perl.org/d/Svsh>
+ 
+=item * Search CPAN
+ 
+L<http://search.cpan.org/dist/Svsh/>
+ 
+=back
+
+=head1 AUTHOR
+
+Ido Perlmuter <ido at ido50 dot net>
+
+=head1 LICENSE AND COPYRIGHT
+
+Copyright (c) 2015, Ido Perlmuter C<< ido at ido50 dot net >>.
+
+This module is free software; you can redistribute it and/or
+modify it under the same terms as Perl itself, either version
+5.8.1 or any later version. See L<perlartistic|perlartistic> 
+and L<perlgpl|perlgpl>.
+
+The full text of the license can be found in the
+LICENSE file included with this module.
+
+=head1 DISCLAIMER OF WARRANTY
+
+BECAUSE THIS SOFTWARE IS LICENSED FREE OF CHARGE, THERE IS NO WARRANTY
+FOR THE SOFTWARE, TO THE EXTENT PERMITTED BY APPLICABLE LAW. EXCEPT WHEN
+OTHERWISE STATED IN WRITING THE COPYRIGHT HOLDERS AND/OR OTHER PARTIES
+PROVIDE THE SOFTWARE "AS IS" WITHOUT WARRANTY OF ANY KIND, EITHER
+EXPRESSED OR IMPLIED, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE. THE
+ENTIRE RISK AS TO THE QUALITY AND PERFORMANCE OF THE SOFTWARE IS WITH
+YOU. SHOULD THE SOFTWARE PROVE DEFECTIVE, YOU ASSUME THE COST OF ALL
+NECESSARY SERVICING, REPAIR, OR CORRECTION.
+
+IN NO EVENT UNLESS REQUIRED BY APPLICABLE LAW OR AGREED TO IN WRITING
+WILL ANY COPYRIGHT HOLDER, OR ANY OTHER PARTY WHO MAY MODIFY AND/OR
+REDISTRIBUTE THE SOFTWARE AS PERMITTED BY THE ABOVE LICENCE, BE
+LIABLE TO YOU FOR DAMAGES, INCLUDING ANY GENERAL, SPECIAL, INCIDENTAL,
+OR CONSEQUENTIAL DAMAGES ARISING OUT OF THE USE OR INABILITY TO USE
+THE SOFTWARE (INCLUDING BUT NOT LIMITED TO LOSS OF DATA OR DATA BEING
+RENDERED INACCURATE OR LOSSES SUSTAINED BY YOU OR THIRD PARTIES OR A
+FAILURE OF THE SOFTWARE TO OPERATE WITH ANY OTHER SOFTWARE), EVEN IF
+SUCH HOLDER OR OTHER PARTY HAS BEEN ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGES.
+
+=cut
+
+1;
+__END__
@@ -0,0 +1,337 @@
+package Svsh::Openrc;
+
+use Moo;
+use namespace::clean;
+
+our $DEFAULT_BASEDIR = '/etc/init.d';
+our $SUPERVISOR = 'openrc';
+our $CONTROL_TOOL = 'rc-service';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('rc-status', 'openrc --version');
+
+# the command printing the version of the suite
+our @VERSION_COMMAND = ('openrc', '--version');
+
+# OpenRC can't signal services, so all signals are sent to their
+# processes directly (see the signal() method of Svsh)
+our %SIGNALS = ();
+
+# the states rc-status reports, and the statuses they translate to
+our %STATES = (
+	started => 'up',
+	starting => 'backoff',
+	crashed => 'backoff',
+	stopping => 'down',
+	stopped => 'down',
+	inactive => 'down',
+	failed => 'down'
+);
+
+with 'Svsh';
+
+=head1 NAME
+
+Svsh::Openrc - OpenRC support for svsh
+
+=head1 DESCRIPTION
+
+This class provides support for L<OpenRC|https://github.com/OpenRC/openrc>
+(the init system of Gentoo and Alpine Linux) to L<svsh> - the supervisor shell.
+
+Services are the init scripts known to OpenRC, listed with C<rc-status --servicelist>,
+and are controlled with C<rc-service>. C<started> services are C<up>, services that
+are C<starting> or have C<crashed> are in C<backoff>, and C<stopped>, C<stopping>,
+C<inactive> or C<failed> services are C<down>.
+
+=head2 DEFAULT BASE DIRECTORY
+
+OpenRC services are the init scripts in C</etc/init.d>, which is the default
+base directory, but services are listed by C<rc-status>, so the base directory
+is only used for display.
+
+=head1 IMPLEMENTED METHODS
+
+Refer to L<Svsh> for complete explanation of these methods. Only changes from
+the base specifications are listed here.
+
+=head2 status()
+
+C<rc-status> reports the uptime of services run by C<supervise-daemon> (and the
+number of times it started them, from which the number of restarts is added under
+the C<restarts> key), other services have a duration of zero. C<rc-status> does
+not report process IDs, so they are read from the C</run/$service.pid> pid file,
+which most init scripts use (locally only).
+
+=cut
+
+sub status {
+	my $self = shift;
+
+	my $statuses = {};
+	foreach ($self->run_cmd('rc-status', '--servicelist')) {
+		my ($service, $status) = $self->_parse_line($_)
+			or next;
+		$statuses->{$service} = $status;
+	}
+
+	return $statuses;
+}
+
+=head2 start( @services )
+
+=cut
+
+sub start {
+	$_[0]->_rc_service('start', @{$_[2]->{args}});
+}
+
+=head2 stop( @services )
+
+=cut
+
+sub stop {
+	$_[0]->_rc_service('stop', @{$_[2]->{args}});
+}
+
+=head2 restart( @services )
+
+=cut
+
+sub restart {
+	$_[0]->_rc_service('restart', @{$_[2]->{args}});
+}
+
+=head2 signal( $signal, @services )
+
+OpenRC can't send signals to services, so signals are sent to their processes
+directly, which requires their process IDs to be known (see L</"status()">).
+
+=cut
+
+sub signal {
+	$_[0]->_translate_signal($_[2]->{args}->[0]);
+}
+
+=head2 reset( @services )
+
+Resets the state of the services (with C<rc-service zap>), e.g. of crashed
+services, and starts them.
+
+=cut
+
+sub reset {
+	$_[0]->_rc_service('zap', @{$_[2]->{args}})
+		. $_[0]->_rc_service('start', @{$_[2]->{args}});
+}
+
+=head2 enable( @services )
+
+Adds the services to the C<default> runlevel (C<rc-update add>).
+
+=cut
+
+sub enable {
+	join('', map { $_[0]->run_cmd('rc-update', 'add', $_, 'default') } @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+Removes the services from the C<default> runlevel (C<rc-update del>).
+
+=cut
+
+sub disable {
+	join('', map { $_[0]->run_cmd('rc-update', 'del', $_, 'default') } @{$_[2]->{args}});
+}
+
+=head2 fg( @services )
+
+=cut
+
+sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+OpenRC doesn't manage logging, but services run by C<start-stop-daemon> or
+C<supervise-daemon> can redirect their output to the file set by the
+C<output_log> variable, in C</etc/conf.d/$service> or in the init script.
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
+	my $config = $self->run_cmd('cat', "/etc/conf.d/$service", $self->basedir.'/'.$service);
+
+	return ($config =~ m/^\s*output_log=["']?([^"'\s]+)/m)[0]
+		|| die "Can't find out the log file of $service (no output_log is set)";
+}
+
+##############################################################
+# _rc_service( $command, @services )
+# runs an rc-service command on every service (rc-service
+# takes one service at a time), in parallel
+##############################################################
+
+sub _rc_service {
+	my ($self, $command, @services) = @_;
+
+	return join('', $self->run_cmds(map { ['rc-service', $_, $command] } @services));
+}
+
+##############################################################
+# _service_dirs()
+# returns the names of all services known to OpenRC; there
+# are no service directories with OpenRC
+##############################################################
+
+sub _service_dirs {
+	my $self = shift;
+
+	return sort keys %{$self->status};
+}
+
+##############################################################
+# _has_service( $service )
+# returns a true value if OpenRC knows a service
+##############################################################
+
+sub _has_service {
+	my ($self, $service) = @_;
+
+	return defined $service && scalar grep { $_ eq $service } $self->_service_dirs;
+}
+
+##############################################################
+# _parse_line( $line )
+# parses a line of rc-status output, returning the name of
+# the service and its status, e.g.:
+#  sshd       [  started 1 day(s) 02:03:04 (2)  ]
+##############################################################
+
+sub _parse_line {
+	my ($self, $line) = @_;
+
+	# rc-status colors its output on terminals
+	$line =~ s/\e\[[\d;]*[A-Za-z]//g;
+
+	my ($service, $state, $details) = $line =~ m/^\s*(\S+)\s+\[\s*(\w+)\s*(.*?)\s*\]\s*$/
+		or return;
+
+	my $status = $STATES{$state};
+	return ($service, $self->_unparsed_status($line))
+		unless $status;
+
+	# supervised services have an uptime, and a count of starts
+	my ($days, $hours, $mins, $secs) = $details =~ m/^(?:(\d+) day\(s\) )?(?:(\d+):)?(\d+):(\d+)/;
+	my ($starts) = $details =~ m/\((\d+)\)/;
+
+	return ($service, {
+		status => $status,
+		duration => defined $secs ? ((($days || 0) * 24 + ($hours || 0)) * 60 + $mins) * 60 + $secs : 0,
+		pid => $status eq 'up' ? $self->_pid($service) : '-',
+		(defined $starts ? (restarts => $starts > 0 ? $starts - 1 : 0) : ())
+	});
+}
+
+##############################################################
+# _pid( $service )
+# returns the process ID of a service from its pid file, if
+# it has one and the process is running
+##############################################################
+
+sub _pid {
+	my ($self, $service) = @_;
+
+	return '-' if $self->host;
+
+	open(my $fh, '<', "/run/$service.pid") || return '-';
+	my ($pid) = (<$fh> || '') =~ m/^(\d+)/;
+	close $fh;
+
+	return $pid && (kill(0, $pid) || $!{EPERM}) ? $pid : '-';
+}
+
+=head1 BUGS AND LIMITATIONS
+
+No bugs have been reported.
+
+Please report any bugs or feature requests to
+C<bug-Svsh@rt.cpan.org>, or through the web interface at
+L<http://rt.cpan.org/NoAuth/ReportBug.html?Queue=Svsh>.
+
+=head1 SUPPORT
+
+You can find documentation for this module with the perldoc command.
+
+	perldoc Svsh::Openrc
+
+You can also look for information at:
+
+=over 4
+ 
+=item * RT: CPAN's request tracker
+ 
+L<http://rt.cpan.org/NoAuth/Bugs.html?Dist=Svsh>
+ 
+=item * AnnoCPAN: Annotated CPAN documentation
+ 
+L<http://annocpan.org/dist/Svsh>
+ 
+=item * CPAN Ratings
+ 
+L<http://cpanratings.perl.org/d/Svsh>
+ 
+=item * Search CPAN
+ 
+L<http://search.cpan.org/dist/Svsh/>
+ 
+=back
+
+=head1 AUTHOR
+
+Ido Perlmuter <ido at ido50 dot net>
+
+=head1 LICENSE AND COPYRIGHT
+
+Copyright (c) 2015, Ido Perlmuter C<< ido at ido50 dot net >>.
+
+This module is free software; you can redistribute it and/or
+modify it under the same terms as Perl itself, either version
+5.8.1 or any later version. See L<perlartistic|perlartistic> 
+and L<perlgpl|perlgpl>.
+
+The full text of the license can be found in the
+LICENSE file included with this module.
+
+=head1 DISCLAIMER OF WARRANTY
+
+BECAUSE THIS SOFTWARE IS LICENSED FREE OF CHARGE, THERE IS NO WARRANTY
+FOR THE SOFTWARE, TO THE EXTENT PERMITTED BY APPLICABLE LAW. EXCEPT WHEN
+OTHERWISE STATED IN WRITING THE COPYRIGHT HOLDERS AND/OR OTHER PARTIES
+PROVIDE THE SOFTWARE "AS IS" WITHOUT WARRANTY OF ANY KIND, EITHER
+EXPRESSED OR IMPLIED, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE. THE
+ENTIRE RISK AS TO THE QUALITY AND PERFORMANCE OF THE SOFTWARE IS WITH
+YOU. SHOULD THE SOFTWARE PROVE DEFECTIVE, YOU ASSUME THE COST OF ALL
+NECESSARY SERVICING, REPAIR, OR CORRECTION.
+
+IN NO EVENT UNLESS REQUIRED BY APPLICABLE LAW OR AGREED TO IN WRITING
+WILL ANY COPYRIGHT HOLDER, OR ANY OTHER PARTY WHO MAY MODIFY AND/OR
+REDISTRIBUTE THE SOFTWARE AS PERMITTED BY THE ABOVE LICENCE, BE
+LIABLE TO YOU FOR DAMAGES, INCLUDING ANY GENERAL, SPECIAL, INCIDENTAL,
+OR CONSEQUENTIAL DAMAGES ARISING OUT OF THE USE OR INABILITY TO USE
+THE SOFTWARE (INCLUDING BUT NOT LIMITED TO LOSS OF DATA OR DATA BEING
+RENDERED INACCURATE OR LOSSES SUSTAINED BY YOU OR THIRD PARTIES OR A
+FAILURE OF THE SOFTWARE TO OPERATE WITH ANY OTHER SOFTWARE), EVEN IF
+SUCH HOLDER OR OTHER PARTY HAS BEEN ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGES.
+
+=cut
+
+1;
+__END__
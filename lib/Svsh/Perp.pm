@@ -4,6 +4,30 @@ use Moo;
 use namespace::clean;
 
 our $DEFAULT_BASEDIR = $ENV{PERP_BASE} || '/etc/perp';
+our $SUPERVISOR = 'perpd';
+our $CONTROL_TOOL = 'perpls';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('perpls', 'perpstat', 'perpctl -V');
+
+# the command printing the version of the suite
+our @VERSION_COMMAND = ('perpctl', '-V');
+
+# signals supported by perpctl, and the perpctl commands sending them
+our %SIGNALS = (
+	HUP => 'h',
+	INT => 'i',
+	QUIT => 'q',
+	KILL => 'k',
+	USR1 => '1',
+	USR2 => '2',
+	ALRM => 'a',
+	TERM => 't',
+	STOP => 'p',
+	CONT => 'c',
+	WINCH => 'w'
+);
 
 with 'Svsh';
 
@@ -43,41 +67,29 @@ sub status {
 	my $statuses = {};
 	foreach ($_[0]->run_cmd('perpls', '-b', $_[0]->basedir, '-g')) {
 		chomp;
-		my @m = m/^
-			\[
-				.\s			# the perpd status
-				(.)(.)(.)\s		# the process status
-				...			# the logger status
-			\]\s+
-			(\S+)\s+			# the process name
-			(?:
-				uptime:\s+
-				([^\/]+)s		# the process uptime
-				\/
-				\S+s			# the logger uptime
-				\s+
-				pids:\s+
-				([^\/]+)		# the process pid
-				\/
-				\S+			# the logger pid
-			)?				# optional because inactive services will not have this
-		/x;
-
-		my $status = $m[0] eq '+' ? $m[2] eq 'r' ? 'resetting' : 'up' :
-				 $m[0] eq '.' ? 'down' :
-				 $m[0] eq '!' ? 'backoff' :
-				 $m[0] eq '-' ? 'disabled' : 'unknown';
-
-		$statuses->{$m[3]} = {
-			status => $status,
-			pid => $status eq 'up' ? $m[5] : '-',
-			duration => $status eq 'up' ? $m[4] eq '-' ? 0 : int($m[4]) : 0
-		};
+		next unless m/\S/;
+
+		my ($name, $status) = $_[0]->_parse_line($_);
+		$statuses->{$name} = $status;
 	}
 
 	return $statuses;
 }
 
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	my ($line) = grep { m/\S/ } $_[0]->run_cmd('perpls', '-b', $_[0]->basedir, '-g', $_[1]);
+
+	return $_[0]->_unparsed_status('')
+		unless defined $line;
+
+	chomp($line);
+	return ($_[0]->_parse_line($line))[1];
+}
+
 =head start( @services )
 
 This uses the C<A> option of C<perpctl> instead of C<u> or C<U>, see
@@ -101,6 +113,19 @@ sub stop {
 	$_[0]->run_cmd('perpctl', '-b', $_[0]->basedir, 'X', @{$_[2]->{args}});
 }
 
+=head2 reset( @services )
+
+Services in backoff are reset by deactivating and reactivating them
+(C<perpctl X> followed by C<perpctl A>), which clears their state and
+starts them immediately.
+
+=cut
+
+sub reset {
+	$_[0]->run_cmd('perpctl', '-b', $_[0]->basedir, 'X', @{$_[2]->{args}}).
+	$_[0]->run_cmd('perpctl', '-b', $_[0]->basedir, 'A', @{$_[2]->{args}});
+}
+
 =head restart( @services )
 
 =cut
@@ -116,28 +141,34 @@ sub restart {
 sub signal {
 	my ($sign, @sv) = @{$_[2]->{args}};
 
-	# convert signal to perpctl command
-	$sign =~ s/^sig//i;
-	my $cmd = $sign =~ m/^usr(1|2)$/i ? $1 : lc(substr($sign, 0, 1));
+	my $cmd = $_[0]->_translate_signal($sign);
 
 	$_[0]->run_cmd('perpctl', '-b', $_[0]->basedir, $cmd, @sv);
 }
 
-=head2 fg( $service )
+=head2 fg( @services )
 
 =cut
 
 sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
 	# find out the pid of the logging process
-	my $text = $_[0]->run_cmd('perpstat', '-b', $_[0]->basedir, $_[2]->{args}->[0]);
+	my $text = $self->run_cmd('perpstat', '-b', $self->basedir, $service);
 	my $pid = ($text =~ m/log:.+\(pid (\d+)\)/)[0]
-		|| die "Can't figure out pid of the logging process";
+		|| die "Can't figure out pid of the logging process of $service";
 
 	# find out the current log file
-	my $logfile = $_[0]->find_logfile($pid)
-		|| die "Can't find out process' log file";
-
-	$_[0]->run_cmd('tail', '-f', $logfile, { as_system => 1 });
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
 }
 
 =head2 rescan()
@@ -156,6 +187,53 @@ sub terminate {
 	$_[0]->run_cmd('perphup', '-t', $_[0]->basedir);
 }
 
+##############################################################
+# _parse_line( $line )
+# parses a line of perpls -g output, returning the name of the
+# service and its status
+##############################################################
+
+sub _parse_line {
+	my ($self, $line) = @_;
+
+	my @m = $line =~ m/^
+		\[
+			.\s			# the perpd status
+			(.)(.)(.)\s		# the process status
+			...			# the logger status
+		\]\s+
+		(\S+)\s+			# the process name
+		(?:
+			uptime:\s+
+			([^\/]+)s		# the process uptime
+			\/
+			\S+s			# the logger uptime
+			\s+
+			pids:\s+
+			([^\/]+)		# the process pid
+			\/
+			\S+			# the logger pid
+		)?				# optional because inactive services will not have this
+	/x;
+
+	unless (scalar @m) {
+		# keep the service, even though we couldn't parse its status
+		my $name = ($line =~ m/^\[[^\]]*\]\s+(\S+)/)[0] || $line;
+		return ($name, $self->_unparsed_status($line));
+	}
+
+	my $status = $m[0] eq '+' ? $m[2] eq 'r' ? 'resetting' : 'up' :
+			 $m[0] eq '.' ? 'down' :
+			 $m[0] eq '!' ? 'backoff' :
+			 $m[0] eq '-' ? 'disabled' : 'unknown';
+
+	return ($m[3], {
+		status => $status,
+		pid => $status eq 'up' ? $m[5] : '-',
+		duration => $status eq 'up' ? $m[4] eq '-' ? 0 : int($m[4]) : 0
+	});
+}
+
 =head1 BUGS AND LIMITATIONS
 
 No bugs have been reported.
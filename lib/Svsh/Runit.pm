@@ -3,9 +3,32 @@ package Svsh::Runit;
 use Moo;
 use namespace::clean;
 
-use Proc::Killall;
-
-our $DEFAULT_BASEDIR = -e '/etc/service' ? '/etc/service' : '/service';
+use File::Spec;
+
+our $DEFAULT_BASEDIR = $ENV{SVDIR} || (-e '/etc/service' ? '/etc/service' : '/service');
+our $SUPERVISOR = 'runsvdir';
+our $CONTROL_TOOL = 'sv';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('sv status');
+
+# signals supported by sv, and the sv commands sending them
+our %SIGNALS = (
+	HUP => 'hup',
+	INT => 'interrupt',
+	QUIT => 'quit',
+	KILL => 'kill',
+	USR1 => '1',
+	USR2 => '2',
+	ALRM => 'alarm',
+	TERM => 'term',
+	STOP => 'pause',
+	CONT => 'cont'
+);
+
+# control characters understood by runsv (see runsv(8))
+our @CONTROLS = qw/u d o c p h a i q 1 2 t k x e/;
 
 with 'Svsh';
 
@@ -22,9 +45,9 @@ to L<svsh> - the supervisor shell.
 
 Traditionally, C<runit> used C</etc/service> as the default base directory,
 but versions 1.9.0 changed the default to C</service>. C<runit> still recommends
-C</etc/service> for FHS compliant systems, so this class uses C</etc/service>
-if it exists, or C</service> otherwise, if a base directory is not provided
-to C<svsh>.
+C</etc/service> for FHS compliant systems. Like C<sv>, this class checks the
+C<SVDIR> environment variable if a base directory is not provided to C<svsh>,
+and then uses C</etc/service> if it exists, or C</service> otherwise.
 
 =head1 IMPLEMENTED METHODS
 
@@ -36,38 +59,47 @@ the base specifications are listed here.
 =cut
 
 sub status {
-	my $statuses = {};
-	foreach ($_[0]->_service_dirs) {
-		my $raw = $_[0]->run_cmd('sv', 'status', $_[0]->basedir.'/'.$_);
+	$_[0]->_query_statuses($_[0]->_service_dirs);
+}
+
+=head2 status_of( $service )
+
+=cut
 
-		my ($status, $pid, $duration) = $raw =~ m/^([^:]+):[^:]+:(?: \(pid (\d+)\))? (\d+)s/;
+sub status_of {
+	$_[0]->_parse_status($_[1], scalar $_[0]->run_cmd('sv', 'status', $_[0]->basedir.'/'.$_[1]));
+}
+
+=head2 statuses_of( @services )
+
+The services are queried in parallel, as with C<status()>.
+
+=cut
 
-		$status = 'up'
-			if $status eq 'run';
+sub statuses_of {
+	my $self = shift;
 
-		$statuses->{$_} = {
-			status => $status,
-			duration => $duration || 0,
-			pid => $pid || '-'
-		};
-	}
-	return $statuses;
+	$self->_query_statuses(@_);
 }
 
-=head start( @services )
+=head2 start( @services )
+
+When waiting, C<sv -v> is used.
 
 =cut
 
 sub start {
-	$_[0]->run_cmd('sv', 'up', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+	$_[0]->run_cmd('sv', $_[0]->_wait_opts($_[2]), 'up', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
 }
 
-=head stop( @services )
+=head2 stop( @services )
+
+When waiting, C<sv -v> is used.
 
 =cut
 
 sub stop {
-	$_[0]->run_cmd('sv', 'down', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+	$_[0]->run_cmd('sv', $_[0]->_wait_opts($_[2]), 'down', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
 }
 
 =head restart( @services )
@@ -78,50 +110,197 @@ sub restart {
 	$_[0]->run_cmd('sv', 'quit', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
 }
 
-=head signal( $signal, @services )
+=head2 signal( $signal, @services )
+
+C<WINCH> is not supported by C<sv>, so it is sent to the process directly.
+C<STOP> and C<CONT> are sent with C<sv pause> and C<sv cont>, respectively.
 
 =cut
 
 sub signal {
 	my ($sign, @sv) = @{$_[2]->{args}};
 
-	# convert signal to perpctl command
-	$sign =~ s/^sig//i;
-	if ($sign =~ m/^usr(1|2)$/) {
-		$sign = $1;
-	} elsif ($sign eq 'alrm') {
-		$sign = 'alarm';
-	} elsif ($sign eq 'int') {
-		$sign = 'interrupt';
-	}
+	$_[0]->run_cmd('sv', $_[0]->_translate_signal($sign), map { $_[0]->basedir.'/'.$_ } @sv);
+}
+
+=head2 force_stop( @services )
+
+Sends C<sv down>, so the services aren't restarted, followed by C<sv kill>.
+C<sv force-stop> isn't used, as it first waits up to 7 seconds for the
+services to stop gracefully.
+
+=cut
+
+sub force_stop {
+	my @dirs = map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}};
+
+	$_[0]->run_cmd('sv', 'down', @dirs) . $_[0]->run_cmd('sv', 'kill', @dirs);
+}
+
+=head2 reset( @services )
+
+C<runsv> only throttles restarts of services that die too quickly for one
+second, so this simply sends C<sv up>, which starts services immediately
+when the throttling delay ends.
+
+=cut
+
+sub reset {
+	$_[0]->run_cmd('sv', 'up', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 once( @services )
+
+=cut
+
+sub once {
+	$_[0]->run_cmd('sv', 'once', map { $_[0]->basedir.'/'.$_ } @{$_[2]->{args}});
+}
+
+=head2 enable( @services )
+
+Removes the C<down> file of the services.
+
+=cut
+
+sub enable {
+	$_[0]->_down_files(0, @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+Creates a C<down> file in the directories of the services.
+
+=cut
 
-	$_[0]->run_cmd('sv', lc($sign), map { $_[0]->basedir.'/'.$_ } @sv);
+sub disable {
+	$_[0]->_down_files(1, @{$_[2]->{args}});
 }
 
-=head2 fg( $service )
+=head2 native_wait( $command )
+
+C<sv> can wait for C<start> and C<stop> to take effect, but not for
+C<restart> (which is implemented with C<sv quit>).
+
+=cut
+
+sub native_wait { $_[1] eq 'start' || $_[1] eq 'stop' }
+
+=head2 fg( @services )
 
 =cut
 
 sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
 	# find out the pid of the logging process
-	my $text = $_[0]->run_cmd('sv', 'status', $_[0]->basedir.'/'.$_[2]->{args}->[0]);
+	my $text = $self->run_cmd('sv', 'status', $self->basedir.'/'.$service);
 	my $pid = ($text =~ m/log: \(pid (\d+)\)/)[0]
-		|| die "Can't figure out pid of the logging process";
+		|| die "Can't figure out pid of the logging process of $service";
 
 	# find out the current log file
-	my $logfile = $_[0]->find_logfile($pid)
-		|| die "Can't find out process' log file";
-
-	$_[0]->run_cmd('tail', '-f', $logfile, { as_system => 1 });
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
 }
 
-=head2 terminate()
+=head2 terminate( [ $dir ] )
+
+Sends a C<HUP> signal to the C<runsvdir> process supervising the base directory.
+If a directory is provided (relative paths are relative to the base directory),
+only the C<runsvdir> process supervising that directory is signaled, which
+allows terminating a nested tree (a child C<runsvdir> supervised by a service
+of the parent tree) while leaving the parent alone. Processes are matched by
+their exact arguments, so C<runsvdir /etc/service> does not match
+C<runsvdir /etc/service-staging>.
 
 =cut
 
 sub terminate {
-	my $basedir = $_[0]->basedir;
-	killall('HUP', "runsvdir $basedir");
+	my $dir = $_[2] && $_[2]->{args} && $_[2]->{args}->[0];
+	$dir = $dir ? File::Spec->rel2abs($dir, $_[0]->basedir) : $_[0]->basedir;
+
+	my @pids = $_[0]->_supervisor_pids($dir, $_[0]->_processes)
+		or die "Can't find a runsvdir process supervising $dir";
+
+	$_[0]->_signal_pids('HUP', @pids);
+}
+
+##############################################################
+# _checks_existence()
+# statuses_of() queries the services whether they exist or
+# not, so the role checks that they do first
+##############################################################
+
+sub _checks_existence { 0 }
+
+##############################################################
+# _wait_opts( \%params )
+# returns the sv options that make it wait (up to the timeout
+# of the wait parameter) for the command to take effect, or
+# nothing if waiting wasn't requested
+##############################################################
+
+sub _wait_opts {
+	my ($self, $params) = @_;
+
+	return unless $params->{wait};
+	return ('-v', '-w', int($params->{wait} + 0.5) || 1);
+}
+
+##############################################################
+# _query_statuses( @services )
+# runs sv status for a list of services in parallel, and
+# returns a hash-ref of their statuses
+##############################################################
+
+sub _query_statuses {
+	my ($self, @services) = @_;
+
+	my @outputs = $self->run_cmds(
+		(map { ['sv', 'status', $self->basedir.'/'.$_] } @services),
+		{ concurrency => $self->status_concurrency }
+	);
+
+	return { map { $_ => $self->_parse_status($_, shift @outputs) } @services };
+}
+
+##############################################################
+# _parse_status( $service, $output )
+# parses the output of sv status for a service, e.g.
+# "run: /etc/service/web: (pid 123) 45s, normally down, got
+# TERM; run: log: (pid 122) 45s" (service directories may
+# contain colons, so the duration ends the name)
+##############################################################
+
+sub _parse_status {
+	my ($self, $service, $raw) = @_;
+
+	my ($status, $pid, $duration, $flags) = $raw =~ m/^(run|down|finish): .+?:(?: \(pid (\d+)\))? (\d+)s([^;]*)/;
+
+	return $self->_unparsed_status($raw)
+		unless $status;
+
+	$status = 'up'
+		if $status eq 'run';
+
+	# the status of the logger, if the service has one, follows
+	my ($log, $log_pid) = $raw =~ m/; (run|down|finish): log:(?: \(pid (\d+)\))?/;
+
+	return {
+		status => $status,
+		want => $self->_want($status, $flags),
+		duration => $duration || 0,
+		pid => $pid || '-',
+		(defined $log ? (log => $log eq 'run' ? 'up' : 'down', log_pid => $log_pid || '-') : ())
+	};
 }
 
 =head1 BUGS AND LIMITATIONS
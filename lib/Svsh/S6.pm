@@ -3,7 +3,36 @@ package Svsh::S6;
 use Moo;
 use namespace::clean;
 
-our $DEFAULT_BASEDIR = '/service';
+use File::Spec;
+
+our $DEFAULT_BASEDIR = $ENV{S6_SERVICE_DIR} ||
+	(grep { -d } '/run/service', '/service', '/var/run/s6/services')[0] ||
+	'/service';
+our $SUPERVISOR = 's6-svscan';
+our $CONTROL_TOOL = 's6-svstat';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = qw/s6-svstat s6-svdt/;
+
+# signals supported by s6-svc, and the options sending them
+our %SIGNALS = (
+	HUP => 'h',
+	INT => 'i',
+	QUIT => 'q',
+	KILL => 'k',
+	USR1 => '1',
+	USR2 => '2',
+	ALRM => 'a',
+	ABRT => 'b',
+	TERM => 't',
+	STOP => 'p',
+	CONT => 'c',
+	WINCH => 'y'
+);
+
+# control characters understood by s6-supervise (see s6-svc)
+our @CONTROLS = qw/a b q h k t i 1 2 p c y r o d D u U x X O Q/;
 
 with 'Svsh';
 
@@ -18,8 +47,12 @@ to L<svsh> - the supervisor shell.
 
 =head2 DEFAULT BASE DIRECTORY
 
-C<s6> does not have a default base directory, but recommends C</service>,
-so that is what will be used if a base directory was not provided to C<svsh>.
+C<s6> does not have a default base directory, so if a base directory was not
+provided to C<svsh>, the C<S6_SERVICE_DIR> environment variable is checked,
+and then the common locations of scan directories: C</run/service> (used by
+C<s6-linux-init> and C<s6-overlay>), C</service> (recommended by C<s6>) and
+C</var/run/s6/services> (used by older versions of C<s6-overlay>). If none of
+them exists, C</service> is used.
 
 =head1 IMPLEMENTED METHODS
 
@@ -28,87 +61,188 @@ the base specifications are listed here.
 
 =head2 status()
 
+If C<s6-svdt> is available (C<s6> 2.10 and up), the number of times every
+service died recently (as recorded in its death tally) is added under the
+C<restarts> key. The state of the logger of services with a F<log>
+subdirectory is added under the C<log> and C<log_pid> keys.
+
 =cut
 
 sub status {
-	my $statuses = {};
-	foreach ($_[0]->_service_dirs) {
-		my $raw = $_[0]->run_cmd('s6-svstat', $_[0]->basedir.'/'.$_);
-		my ($status, $comment, $seconds) = ($raw =~ m/(up|down) \(([^\)]+)\) (\d+)/);
-		$statuses->{$_} = {
-			status => $status,
-			duration => $seconds,
-			pid => '-'
-		};
-
-		if ($comment =~ m/pid (\d+)/) {
-			$statuses->{$_}->{pid} = $1;
-		}
-	}
-	return $statuses;
+	$_[0]->_query_statuses($_[0]->_service_dirs);
+}
+
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	$_[0]->_parse_status(
+		$_[1],
+		scalar $_[0]->run_cmd('s6-svstat', $_[0]->basedir.'/'.$_[1]),
+		$_[0]->_has_svdt ? scalar $_[0]->run_cmd('s6-svdt', $_[0]->basedir.'/'.$_[1]) : undef,
+		$_[0]->host || -d $_[0]->basedir."/$_[1]/log" ? scalar $_[0]->run_cmd('s6-svstat', $_[0]->basedir."/$_[1]/log") : undef
+	);
+}
+
+=head2 statuses_of( @services )
+
+The services (and their death tallies and loggers) are queried in parallel, as
+with C<status()>.
+
+=cut
+
+sub statuses_of {
+	my $self = shift;
+
+	$self->_query_statuses(@_);
 }
 
 =head2 start( @services )
 
+When waiting, C<s6-svc -wU> is used, i.e. waits until the services are up
+and ready (if they support readiness notification).
+
 =cut
 
 sub start {
-	foreach (@{$_[2]->{args}}) {
-		$_[0]->run_cmd('s6-svc', '-u', $_[0]->basedir.'/'.$_);
-	}
+	join('', map {
+		$_[0]->run_cmd('s6-svc', $_[0]->_wait_opts($_[2], 'U'), '-u', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
 }
 
 =head2 stop( @services )
 
+When waiting, C<s6-svc -wd> is used.
+
 =cut
 
 sub stop {
-	foreach (@{$_[2]->{args}}) {
-		$_[0]->run_cmd('s6-svc', '-Dd', $_[0]->basedir.'/'.$_);
-	}
+	join('', map {
+		$_[0]->run_cmd('s6-svc', $_[0]->_wait_opts($_[2], 'd'), '-Dd', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
 }
 
 =head2 restart( @services )
 
+Sends C<s6-svc -ru>, i.e. brings the services down with their down signal
+(C<TERM>, unless overridden by a F<down-signal> file), and back up again.
+Services which were not running are simply started. When waiting,
+C<s6-svc -wR> is used, i.e. waits until the services were restarted and are
+ready.
+
 =cut
 
 sub restart {
-	foreach (@{$_[2]->{args}}) {
-		$_[0]->run_cmd('s6-svc', '-q', $_[0]->basedir.'/'.$_);
-	}
+	join('', map {
+		$_[0]->run_cmd('s6-svc', $_[0]->_wait_opts($_[2], 'R'), '-ru', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
+}
+
+=head2 force_stop( @services )
+
+Sends C<s6-svc -dk>, i.e. brings the services down and kills them.
+
+=cut
+
+sub force_stop {
+	join('', map {
+		$_[0]->run_cmd('s6-svc', '-dk', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
+}
+
+=head2 reset( @services )
+
+C<s6-supervise> only throttles restarts of services that die too quickly
+for one second, so this simply sends C<s6-svc -u>, which starts services
+immediately when the throttling delay ends.
+
+=cut
+
+sub reset {
+	join('', map {
+		$_[0]->run_cmd('s6-svc', '-u', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
+}
+
+=head2 once( @services )
+
+=cut
+
+sub once {
+	join('', map {
+		$_[0]->run_cmd('s6-svc', $_[0]->_wait_opts($_[2], 'U'), '-o', $_[0]->basedir.'/'.$_)
+	} @{$_[2]->{args}});
+}
+
+=head2 enable( @services )
+
+Removes the C<down> file of the services.
+
+=cut
+
+sub enable {
+	$_[0]->_down_files(0, @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+Creates a C<down> file in the directories of the services.
+
+=cut
+
+sub disable {
+	$_[0]->_down_files(1, @{$_[2]->{args}});
 }
 
+=head2 native_wait( $command )
+
+C<s6-svc> can wait for C<start>, C<stop>, C<restart> and C<once> to take
+effect. Other commands (e.g. C<reset> and C<kill>) are polled for.
+
+=cut
+
+sub native_wait { $_[1] =~ m/^(start|stop|restart|once)$/ }
+
 =head2 signal( $signal, @services )
 
+In addition to the common signals, C<ABRT> and C<WINCH> are supported.
+
 =cut
 
 sub signal {
 	my ($sign, @sv) = @{$_[2]->{args}};
 
-	# convert signal to perpctl command
-	$sign =~ s/^sig//i;
-	my $cmd = $sign =~ m/^usr(1|2)$/i ? $1 : lc(substr($sign, 0, 1));
+	my $cmd = $_[0]->_translate_signal($sign);
 
 	foreach (@sv) {
 		$_[0]->run_cmd('s6-svc', "-$cmd", $_[0]->basedir.'/'.$_);
 	}
 }
 
-=head2 fg( $service )
+=head2 fg( @services )
 
 =cut
 
 sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
 	# find out the pid of the logging process
-	my $text = $_[0]->run_cmd('s6-svstat', $_[0]->basedir.'/'.$_[2]->{args}->[0].'/log');
+	my $text = $self->run_cmd('s6-svstat', $self->basedir.'/'.$service.'/log');
 	my $pid = ($text =~ m/\(pid (\d+)\)/)[0]
-		|| die "Can't figure out pid of the logging process";
+		|| die "Can't figure out pid of the logging process of $service";
 
 	# find out the current log file
-	my $logfile = $_[0]->find_logfile($pid)
-		|| die "Can't find out process' log file";
-
-	$_[0]->run_cmd('tail', '-f', $logfile, { as_system => 1 });
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
 }
 
 =head2 rescan()
@@ -119,12 +253,107 @@ sub rescan {
 	$_[0]->run_cmd('s6-svscanctl', '-a', $_[0]->basedir);
 }
 
-=head2 terminate()
+=head2 terminate( [ $dir ] )
+
+If a directory is provided (relative paths are relative to the base directory),
+the C<s6-svscan> process of that scan directory is terminated instead.
 
 =cut
 
 sub terminate {
-	$_[0]->run_cmd('s6-svscanctl', '-t', $_[0]->basedir);
+	my $dir = $_[2] && $_[2]->{args} && $_[2]->{args}->[0];
+	$_[0]->run_cmd('s6-svscanctl', '-t', $dir ? File::Spec->rel2abs($dir, $_[0]->basedir) : $_[0]->basedir);
+}
+
+##############################################################
+# _checks_existence()
+# statuses_of() queries the services whether they exist or
+# not, so the role checks that they do first
+##############################################################
+
+sub _checks_existence { 0 }
+
+##############################################################
+# _query_statuses( @services )
+# queries the statuses of a list of services (and their death
+# tallies and loggers) in parallel, returning a hash-ref of
+# them. remotely, the logger of every service is queried, and
+# those that don't exist simply fail to report
+##############################################################
+
+sub _query_statuses {
+	my ($self, @services) = @_;
+
+	my @logged = grep { $self->host || -d $self->basedir."/$_/log" } @services;
+	my $svdt = $self->_has_svdt;
+	my @outputs = $self->run_cmds(
+		(map { ['s6-svstat', $self->basedir.'/'.$_] } @services),
+		($svdt ? (map { ['s6-svdt', $self->basedir.'/'.$_] } @services) : ()),
+		(map { ['s6-svstat', $self->basedir."/$_/log"] } @logged),
+		{ concurrency => $self->status_concurrency }
+	);
+	my %loggers;
+	@loggers{@logged} = splice(@outputs, -scalar @logged)
+		if scalar @logged;
+	my @tallies = $svdt ? splice(@outputs, scalar @services) : ();
+
+	return { map { $_ => $self->_parse_status($_, shift @outputs, shift @tallies, $loggers{$_}) } @services };
+}
+
+##############################################################
+# _parse_status( $service, $output, [ $tally ] )
+# parses the output of s6-svstat for a service, and the
+# output of s6-svdt (one line per recorded death) and that of
+# s6-svstat for its logger if given
+##############################################################
+
+sub _parse_status {
+	my ($self, $service, $raw, $tally, $logger) = @_;
+
+	my ($status, $comment, $seconds) = ($raw =~ m/(up|down) \(([^\)]+)\) (\d+)/);
+
+	return $self->_unparsed_status($raw)
+		unless $status;
+
+	# deaths are recorded as TAI64N timestamps, anything else
+	# (e.g. an error) means the tally couldn't be read
+	my @deaths = defined $tally ? split(/\n/, $tally) : ();
+	my $restarts = defined $tally && !grep({ !m/^@[0-9a-f]+ / } @deaths) ? scalar @deaths : undef;
+
+	my ($log, $log_comment) = defined $logger ? $logger =~ m/^(up|down) \(([^\)]+)\)/ : ();
+
+	return {
+		status => $status,
+		want => $self->_want($status, $raw),
+		duration => $seconds,
+		pid => $comment =~ m/pid (\d+)/ ? $1 : '-',
+		(defined $restarts ? (restarts => $restarts) : ()),
+		(defined $log ? (log => $log, log_pid => $log_comment =~ m/pid (\d+)/ ? $1 : '-') : ())
+	};
+}
+
+##############################################################
+# _has_svdt()
+# returns a true value if s6-svdt, which reads the death tally
+# of services, is available (it was added in s6 2.10)
+##############################################################
+
+sub _has_svdt {
+	return eval { $_[0]->_resolve_cmd('s6-svdt'); 1 };
+}
+
+##############################################################
+# _wait_opts( \%params, $condition )
+# returns the s6-svc options that make it wait (up to the
+# timeout of the wait parameter) for the provided condition,
+# or nothing if waiting wasn't requested
+##############################################################
+
+sub _wait_opts {
+	my ($self, $params, $condition) = @_;
+
+	return unless $params->{wait};
+	return ("-w$condition", '-T', int($params->{wait} * 1000));
 }
 
 =head1 BUGS AND LIMITATIONS
@@ -0,0 +1,374 @@
+package Svsh::S6rc;
+
+use Moo;
+use namespace::clean;
+
+our $DEFAULT_BASEDIR = '/run/service';
+our $SUPERVISOR = 's6-svscan';
+our $CONTROL_TOOL = 's6-rc';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('s6-rc -a list', 's6-rc-db', 's6-svstat');
+
+# signals supported by s6-svc, and the options sending them
+our %SIGNALS = (
+	HUP => 'h',
+	INT => 'i',
+	QUIT => 'q',
+	KILL => 'k',
+	USR1 => '1',
+	USR2 => '2',
+	ALRM => 'a',
+	ABRT => 'b',
+	TERM => 't',
+	STOP => 'p',
+	CONT => 'c',
+	WINCH => 'y'
+);
+
+with 'Svsh';
+
+=head1 NAME
+
+Svsh::S6rc - s6-rc support for svsh
+
+=head1 DESCRIPTION
+
+This class provides support for L<s6-rc|http://www.skarnet.org/software/s6-rc/>
+to L<svsh> - the supervisor shell.
+
+While L<Svsh::S6> manages the services of an C<s6> scan directory directly,
+this class manages the services of the live C<s6-rc> database: longruns, which
+are supervised by C<s6> in the scan directory, and oneshots, which are listed
+as C<up> when they are active and C<down> otherwise. Services (and bundles)
+are started and stopped with C<s6-rc change>, so their dependencies are
+honoured.
+
+=head2 DEFAULT BASE DIRECTORY
+
+The base directory is the scan directory on which C<s6-rc> was initialized,
+C</run/service> by default.
+
+=head1 IMPLEMENTED METHODS
+
+Refer to L<Svsh> for complete explanation of these methods. Only changes from
+the base specifications are listed here.
+
+=head2 status()
+
+Services are listed with C<s6-rc-db>, oneshots are C<up> if C<s6-rc -a list>
+lists them, and the status of longruns is read with C<s6-svstat>.
+
+=cut
+
+sub status {
+	my $self = shift;
+
+	my $types = $self->_types;
+	my %active = map { chomp; $_ => 1 } $self->run_cmd('s6-rc', '-a', 'list');
+
+	# query all longruns in parallel
+	my @longruns = sort grep { $types->{$_} eq 'longrun' } keys %$types;
+	my @outputs = $self->run_cmds(
+		(map { ['s6-svstat', $self->basedir.'/'.$_] } @longruns),
+		{ concurrency => $self->status_concurrency }
+	);
+
+	my $statuses = {};
+	$statuses->{$_} = $self->_parse_status($_, shift @outputs)
+		foreach @longruns;
+	$statuses->{$_} = { status => $active{$_} ? 'up' : 'down', duration => 0, pid => '-' }
+		foreach grep { $types->{$_} eq 'oneshot' } keys %$types;
+
+	return $statuses;
+}
+
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	my ($self, $service) = @_;
+
+	return $self->_parse_status($service, scalar $self->run_cmd('s6-svstat', $self->basedir.'/'.$service))
+		if $self->_types->{$service} eq 'longrun';
+
+	return {
+		status => (grep { chomp; $_ eq $service } $self->run_cmd('s6-rc', '-a', 'list')) ? 'up' : 'down',
+		duration => 0,
+		pid => '-'
+	};
+}
+
+=head2 start( @services )
+
+Services and bundles are brought up with C<s6-rc -u change>, along with their
+dependencies. C<s6-rc> waits for the transition to complete, up to the timeout
+of the C<wait> parameter if provided.
+
+=cut
+
+sub start {
+	$_[0]->run_cmd('s6-rc', $_[0]->_wait_opts($_[2]), '-u', 'change', @{$_[2]->{args}});
+}
+
+=head2 stop( @services )
+
+Services and bundles are brought down with C<s6-rc -d change>, along with the
+services depending on them.
+
+=cut
+
+sub stop {
+	$_[0]->run_cmd('s6-rc', $_[0]->_wait_opts($_[2]), '-d', 'change', @{$_[2]->{args}});
+}
+
+=head2 restart( @services )
+
+Longruns are restarted with C<s6-svc -r>, without affecting other services.
+Oneshots and bundles are brought down and up again with C<s6-rc change>.
+
+=cut
+
+sub restart {
+	my $types = $_[0]->_types;
+	my @longruns = grep { ($types->{$_} || '') eq 'longrun' } @{$_[2]->{args}};
+	my @others = grep { ($types->{$_} || '') ne 'longrun' } @{$_[2]->{args}};
+
+	my $output = join('', map { $_[0]->run_cmd('s6-svc', '-r', $_[0]->basedir.'/'.$_) } @longruns);
+
+	$output .= $_[0]->run_cmd('s6-rc', '-d', 'change', @others)
+		. $_[0]->run_cmd('s6-rc', '-u', 'change', @others)
+			if scalar @others;
+
+	return $output;
+}
+
+=head2 signal( $signal, @services )
+
+Only longruns have processes to signal. In addition to the common signals,
+C<ABRT> and C<WINCH> are supported.
+
+=cut
+
+sub signal {
+	my ($sign, @sv) = @{$_[2]->{args}};
+
+	my $cmd = $_[0]->_translate_signal($sign);
+
+	$_[0]->_check_longruns('signal', @sv);
+
+	foreach (@sv) {
+		$_[0]->run_cmd('s6-svc', "-$cmd", $_[0]->basedir.'/'.$_);
+	}
+}
+
+=head2 native_wait( $command )
+
+C<s6-rc> always waits for C<start> and C<stop> to take effect, but C<s6-svc -r>
+doesn't wait for restarts.
+
+=cut
+
+sub native_wait { $_[1] eq 'start' || $_[1] eq 'stop' }
+
+=head2 fg( @services )
+
+=cut
+
+sub fg {
+	$_[0]->follow_logs({ map { $_ => $_[0]->logfile($_) } @{$_[2]->{args}} }, $_[2]);
+}
+
+=head2 logfile( $service )
+
+The logger of a longrun is the last service of its pipeline (as listed by
+C<s6-rc-db pipeline>). Oneshots have no log to follow.
+
+=cut
+
+sub logfile {
+	my ($self, $service) = @_;
+
+	$self->_check_longruns('fg', $service);
+
+	# find out the pid of the logging process
+	my ($logger) = grep { $_ ne $service } reverse map { chomp; $_ } $self->run_cmd('s6-rc-db', 'pipeline', $service);
+	my $text = $logger ? $self->run_cmd('s6-svstat', $self->basedir.'/'.$logger) : '';
+	my $pid = ($text =~ m/\(pid (\d+)\)/)[0]
+		|| die "Can't figure out pid of the logging process of $service";
+
+	# find out the current log file
+	return $self->find_logfile($pid)
+		|| die "Can't find out the log file of $service";
+}
+
+##############################################################
+# _types()
+# returns a hash-ref of the atomic services of the live
+# database, and their types (longrun or oneshot)
+##############################################################
+
+sub _types {
+	my $self = shift;
+
+	my ($longruns, $oneshots) = $self->run_cmds(['s6-rc-db', 'list', 'longruns'], ['s6-rc-db', 'list', 'oneshots']);
+
+	my $types = {};
+	$types->{$_} = 'longrun' foreach grep { length } split(/\n/, $longruns);
+	$types->{$_} = 'oneshot' foreach grep { length } split(/\n/, $oneshots);
+
+	return $types;
+}
+
+##############################################################
+# _check_longruns( $command, @services )
+# dies if any of the services isn't a longrun, since the
+# command can't be applied to it
+##############################################################
+
+sub _check_longruns {
+	my ($self, $command, @services) = @_;
+
+	my $types = $self->_types;
+
+	foreach (@services) {
+		die "The $command command is not supported for $_, which is not a longrun\n"
+			unless ($types->{$_} || '') eq 'longrun';
+	}
+}
+
+##############################################################
+# _service_dirs()
+# returns the names of all atomic services of the live
+# database, not just the longruns in the scan directory
+##############################################################
+
+sub _service_dirs {
+	return sort keys %{$_[0]->_types};
+}
+
+##############################################################
+# _has_service( $service )
+# returns a true value if a service is in the live database
+##############################################################
+
+sub _has_service {
+	return defined $_[1] && exists $_[0]->_types->{$_[1]};
+}
+
+##############################################################
+# _parse_status( $service, $output )
+# parses the output of s6-svstat for a longrun
+##############################################################
+
+sub _parse_status {
+	my ($self, $service, $raw) = @_;
+
+	my ($status, $comment, $seconds) = ($raw =~ m/(up|down) \(([^\)]+)\) (\d+)/);
+
+	return $self->_unparsed_status($raw)
+		unless $status;
+
+	return {
+		status => $status,
+		want => $self->_want($status, $raw),
+		duration => $seconds,
+		pid => $comment =~ m/pid (\d+)/ ? $1 : '-'
+	};
+}
+
+##############################################################
+# _wait_opts( \%params )
+# returns the s6-rc options limiting how long it waits for
+# a transition (the timeout of the wait parameter), or
+# nothing if waiting wasn't requested
+##############################################################
+
+sub _wait_opts {
+	my ($self, $params) = @_;
+
+	return unless $params->{wait};
+	return ('-t', int($params->{wait} * 1000));
+}
+
+=head1 BUGS AND LIMITATIONS
+
+No bugs have been reported.
+
+Please report any bugs or feature requests to
+C<bug-Svsh@rt.cpan.org>, or through the web interface at
+L<http://rt.cpan.org/NoAuth/ReportBug.html?Queue=Svsh>.
+
+=head1 SUPPORT
+
+You can find documentation for this module with the perldoc command.
+
+	perldoc Svsh::S6rc
+
+You can also look for information at:
+
+=over 4
+ 
+=item * RT: CPAN's request tracker
+ 
+L<http://rt.cpan.org/NoAuth/Bugs.html?Dist=Svsh>
+ 
+=item * AnnoCPAN: Annotated CPAN documentation
+ 
+L<http://annocpan.org/dist/Svsh>
+ 
+=item * CPAN Ratings
+ 
+L<http://cpanratings.perl.org/d/Svsh>
+ 
+=item * Search CPAN
+ 
+L<http://search.cpan.org/dist/Svsh/>
+ 
+=back
+
+=head1 AUTHOR
+
+Ido Perlmuter <ido at ido50 dot net>
+
+=head1 LICENSE AND COPYRIGHT
+
+Copyright (c) 2015, Ido Perlmuter C<< ido at ido50 dot net >>.
+
+This module is free software; you can redistribute it and/or
+modify it under the same terms as Perl itself, either version
+5.8.1 or any later version. See L<perlartistic|perlartistic> 
+and L<perlgpl|perlgpl>.
+
+The full text of the license can be found in the
+LICENSE file included with this module.
+
+=head1 DISCLAIMER OF WARRANTY
+
+BECAUSE THIS SOFTWARE IS LICENSED FREE OF CHARGE, THERE IS NO WARRANTY
+FOR THE SOFTWARE, TO THE EXTENT PERMITTED BY APPLICABLE LAW. EXCEPT WHEN
+OTHERWISE STATED IN WRITING THE COPYRIGHT HOLDERS AND/OR OTHER PARTIES
+PROVIDE THE SOFTWARE "AS IS" WITHOUT WARRANTY OF ANY KIND, EITHER
+EXPRESSED OR IMPLIED, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE. THE
+ENTIRE RISK AS TO THE QUALITY AND PERFORMANCE OF THE SOFTWARE IS WITH
+YOU. SHOULD THE SOFTWARE PROVE DEFECTIVE, YOU ASSUME THE COST OF ALL
+NECESSARY SERVICING, REPAIR, OR CORRECTION.
+
+IN NO EVENT UNLESS REQUIRED BY APPLICABLE LAW OR AGREED TO IN WRITING
+WILL ANY COPYRIGHT HOLDER, OR ANY OTHER PARTY WHO MAY MODIFY AND/OR
+REDISTRIBUTE THE SOFTWARE AS PERMITTED BY THE ABOVE LICENCE, BE
+LIABLE TO YOU FOR DAMAGES, INCLUDING ANY GENERAL, SPECIAL, INCIDENTAL,
+OR CONSEQUENTIAL DAMAGES ARISING OUT OF THE USE OR INABILITY TO USE
+THE SOFTWARE (INCLUDING BUT NOT LIMITED TO LOSS OF DATA OR DATA BEING
+RENDERED INACCURATE OR LOSSES SUSTAINED BY YOU OR THIRD PARTIES OR A
+FAILURE OF THE SOFTWARE TO OPERATE WITH ANY OTHER SOFTWARE), EVEN IF
+SUCH HOLDER OR OTHER PARTY HAS BEEN ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGES.
+
+=cut
+
+1;
+__END__
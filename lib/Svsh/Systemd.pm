@@ -0,0 +1,351 @@
+package Svsh::Systemd;
+
+use Moo;
+use namespace::clean;
+
+our $DEFAULT_BASEDIR = '/etc/systemd/system';
+our $SUPERVISOR = 'systemd';
+our $CONTROL_TOOL = 'systemctl';
+
+# commands that only query the supervisor, which run even in
+# dry-run mode
+our @QUERIES = ('systemctl show', 'systemctl list-units', 'journalctl', 'systemctl --version');
+
+# the command printing the version of the suite
+our @VERSION_COMMAND = ('systemctl', '--version');
+
+# signals sent with systemctl kill, which takes their names
+our %SIGNALS = map { $_ => $_ } qw/HUP INT QUIT KILL USR1 USR2 ALRM ABRT TERM STOP CONT WINCH/;
+
+# systemd's active states, and the statuses they translate to
+our %STATES = (
+	active => 'up',
+	reloading => 'up',
+	inactive => 'down',
+	failed => 'down',
+	deactivating => 'down',
+	activating => 'backoff'
+);
+
+# the properties of units read by systemctl show
+our @PROPERTIES = qw/Id ActiveState SubState MainPID NRestarts ActiveEnterTimestampMonotonic InactiveEnterTimestampMonotonic/;
+
+with 'Svsh';
+
+=head1 NAME
+
+Svsh::Systemd - systemd support for svsh
+
+=head1 DESCRIPTION
+
+This class provides support for L<systemd|https://systemd.io/>
+to L<svsh> - the supervisor shell.
+
+Services are the C<systemd> service units loaded by the system manager, named
+without their C<.service> suffix, and are controlled with C<systemctl>. Services
+in the C<active> state are C<up>, services that are C<activating> (including
+services waiting to be restarted) are in C<backoff>, and C<inactive> or C<failed>
+services are C<down>.
+
+=head2 DEFAULT BASE DIRECTORY
+
+C<systemd> services do not live in a base directory, so the base directory is
+only used for display. It defaults to C</etc/systemd/system>, the directory of
+the system administrator's units.
+
+=head1 IMPLEMENTED METHODS
+
+Refer to L<Svsh> for complete explanation of these methods. Only changes from
+the base specifications are listed here.
+
+=head2 status()
+
+The services are listed with C<systemctl list-units>, and their state is read
+with C<systemctl show>. The number of times systemd restarted every service
+(C<NRestarts>, systemd 235 and up) is added under the C<restarts> key.
+
+=cut
+
+sub status {
+	my $self = shift;
+
+	my @services = $self->_service_dirs
+		or return {};
+
+	return $self->_parse_show(scalar $self->run_cmd('systemctl', 'show', '-p', join(',', @PROPERTIES), map { "$_.service" } @services));
+}
+
+=head2 status_of( $service )
+
+=cut
+
+sub status_of {
+	my ($self, $service) = @_;
+
+	return $self->_parse_show(scalar $self->run_cmd('systemctl', 'show', '-p', join(',', @PROPERTIES), "$service.service"))->{$service};
+}
+
+=head2 start( @services )
+
+Jobs are queued without waiting for them to finish (C<systemctl --no-block>);
+waiting is done by polling the status of the services.
+
+=cut
+
+sub start {
+	$_[0]->run_cmd('systemctl', '--no-block', 'start', map { "$_.service" } @{$_[2]->{args}});
+}
+
+=head2 stop( @services )
+
+=cut
+
+sub stop {
+	$_[0]->run_cmd('systemctl', '--no-block', 'stop', map { "$_.service" } @{$_[2]->{args}});
+}
+
+=head2 restart( @services )
+
+=cut
+
+sub restart {
+	$_[0]->run_cmd('systemctl', '--no-block', 'restart', map { "$_.service" } @{$_[2]->{args}});
+}
+
+=head2 force_stop( @services )
+
+Queues a stop job for the services, so they aren't restarted, and kills all
+of their processes with C<systemctl kill --signal=KILL>.
+
+=cut
+
+sub force_stop {
+	my @units = map { "$_.service" } @{$_[2]->{args}};
+
+	$_[0]->run_cmd('systemctl', '--no-block', 'stop', @units)
+		. $_[0]->run_cmd('systemctl', 'kill', '--signal=KILL', @units);
+}
+
+=head2 signal( $signal, @services )
+
+Signals are sent to the main process of the services with C<systemctl kill>.
+
+=cut
+
+sub signal {
+	my ($sign, @sv) = @{$_[2]->{args}};
+
+	$_[0]->run_cmd('systemctl', 'kill', '--kill-who=main', '--signal='.$_[0]->_translate_signal($sign), map { "$_.service" } @sv);
+}
+
+=head2 reset( @services )
+
+Clears the failed state of the services (C<systemctl reset-failed>), which also
+resets their start rate limiting, and starts them.
+
+=cut
+
+sub reset {
+	my @units = map { "$_.service" } @{$_[2]->{args}};
+
+	$_[0]->run_cmd('systemctl', 'reset-failed', @units)
+		. $_[0]->run_cmd('systemctl', '--no-block', 'start', @units);
+}
+
+=head2 enable( @services )
+
+=cut
+
+sub enable {
+	$_[0]->run_cmd('systemctl', 'enable', map { "$_.service" } @{$_[2]->{args}});
+}
+
+=head2 disable( @services )
+
+=cut
+
+sub disable {
+	$_[0]->run_cmd('systemctl', 'disable', map { "$_.service" } @{$_[2]->{args}});
+}
+
+=head2 rescan()
+
+Reloads the configuration of the system manager (C<systemctl daemon-reload>).
+
+=cut
+
+sub rescan {
+	$_[0]->run_cmd('systemctl', 'daemon-reload');
+}
+
+=head2 fg( @services )
+
+C<systemd> services log to the journal, so this follows the journal of the
+services with C<journalctl -f> until it is interrupted (the journal already
+names the service of every line). The C<lines> and C<since> parameters are
+passed to C<journalctl> as C<-n> and C<--since>.
+
+=cut
+
+sub fg {
+	my @from = defined $_[2]->{since} ? ('--since', '@'.int(time - $_[2]->{since})) :
+		defined $_[2]->{lines} ? ('-n', $_[2]->{lines}) : ();
+
+	$_[0]->run_cmd('journalctl', @from, '-f', (map { ('-u', "$_.service") } @{$_[2]->{args}}), { as_system => 1 });
+}
+
+=head2 logs( $service, [ $lines ] )
+
+The last lines of the service's journal are read with C<journalctl -n>.
+
+=cut
+
+sub logs {
+	my ($self, $service, $lines) = @_;
+
+	return $self->run_cmd('journalctl', '--no-pager', '-n', $lines || 50, '-u', "$service.service");
+}
+
+##############################################################
+# _service_dirs()
+# returns the names of all loaded service units; there are
+# no service directories with systemd
+##############################################################
+
+sub _service_dirs {
+	my $self = shift;
+
+	return sort map { m/^(\S+)\.service\s/ ? $1 : () }
+		$self->run_cmd('systemctl', 'list-units', '--type=service', '--all', '--no-legend', '--plain');
+}
+
+##############################################################
+# _has_service( $service )
+# returns a true value if a service unit is loaded
+##############################################################
+
+sub _has_service {
+	my ($self, $service) = @_;
+
+	return defined $service && scalar grep { $_ eq $service } $self->_service_dirs;
+}
+
+##############################################################
+# _parse_show( $output )
+# parses the output of systemctl show, which lists the
+# properties of every unit as key=value lines, with an
+# empty line between units
+##############################################################
+
+sub _parse_show {
+	my ($self, $output) = @_;
+
+	# durations are measured on the monotonic clock, which
+	# counts from boot, so they are relative to the uptime
+	my ($uptime) = $self->run_cmd('cat', '/proc/uptime') =~ m/^(\d+(?:\.\d+)?)/;
+
+	my $statuses = {};
+	foreach my $unit (split(/\n\s*\n/, $output)) {
+		my %props = map { m/^([^=]+)=(.*)$/ ? ($1 => $2) : () } split(/\n/, $unit);
+
+		my ($service) = ($props{Id} || '') =~ m/^(.+)\.service$/
+			or next;
+
+		my $status = $STATES{$props{ActiveState} || ''};
+		unless ($status) {
+			$statuses->{$service} = $self->_unparsed_status($unit);
+			next;
+		}
+
+		my $since = $status eq 'up' ? $props{ActiveEnterTimestampMonotonic} : $props{InactiveEnterTimestampMonotonic};
+
+		$statuses->{$service} = {
+			status => $status,
+			duration => $uptime && $since ? int($uptime - $since / 1_000_000) : 0,
+			pid => $props{MainPID} || '-',
+			(defined $props{NRestarts} && length $props{NRestarts} ? (restarts => $props{NRestarts}) : ())
+		};
+	}
+
+	return $statuses;
+}
+
+=head1 BUGS AND LIMITATIONS
+
+No bugs have been reported.
+
+Please report any bugs or feature requests to
+C<bug-Svsh@rt.cpan.org>, or through the web interface at
+L<http://rt.cpan.org/NoAuth/ReportBug.html?Queue=Svsh>.
+
+=head1 SUPPORT
+
+You can find documentation for this module with the perldoc command.
+
+	perldoc Svsh::Systemd
+
+You can also look for information at:
+
+=over 4
+ 
+=item * RT: CPAN's request tracker
+ 
+L<http://rt.cpan.org/NoAuth/Bugs.html?Dist=Svsh>
+ 
+=item * AnnoCPAN: Annotated CPAN documentation
+ 
+L<http://annocpan.org/dist/Svsh>
+ 
+=item * CPAN Ratings
+ 
+L<http://cpanratings.perl.org/d/Svsh>
+ 
+=item * Search CPAN
+ 
+L<http://search.cpan.org/dist/Svsh/>
+ 
+=back
+
+=head1 AUTHOR
+
+Ido Perlmuter <ido at ido50 dot net>
+
+=head1 LICENSE AND COPYRIGHT
+
+Copyright (c) 2015, Ido Perlmuter C<< ido at ido50 dot net >>.
+
+This module is free software; you can redistribute it and/or
+modify it under the same terms as Perl itself, either version
+5.8.1 or any later version. See L<perlartistic|perlartistic> 
+and L<perlgpl|perlgpl>.
+
+The full text of the license can be found in the
+LICENSE file included with this module.
+
+=head1 DISCLAIMER OF WARRANTY
+
+BECAUSE THIS SOFTWARE IS LICENSED FREE OF CHARGE, THERE IS NO WARRANTY
+FOR THE SOFTWARE, TO THE EXTENT PERMITTED BY APPLICABLE LAW. EXCEPT WHEN
+OTHERWISE STATED IN WRITING THE COPYRIGHT HOLDERS AND/OR OTHER PARTIES
+PROVIDE THE SOFTWARE "AS IS" WITHOUT WARRANTY OF ANY KIND, EITHER
+EXPRESSED OR IMPLIED, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE. THE
+ENTIRE RISK AS TO THE QUALITY AND PERFORMANCE OF THE SOFTWARE IS WITH
+YOU. SHOULD THE SOFTWARE PROVE DEFECTIVE, YOU ASSUME THE COST OF ALL
+NECESSARY SERVICING, REPAIR, OR CORRECTION.
+
+IN NO EVENT UNLESS REQUIRED BY APPLICABLE LAW OR AGREED TO IN WRITING
+WILL ANY COPYRIGHT HOLDER, OR ANY OTHER PARTY WHO MAY MODIFY AND/OR
+REDISTRIBUTE THE SOFTWARE AS PERMITTED BY THE ABOVE LICENCE, BE
+LIABLE TO YOU FOR DAMAGES, INCLUDING ANY GENERAL, SPECIAL, INCIDENTAL,
+OR CONSEQUENTIAL DAMAGES ARISING OUT OF THE USE OR INABILITY TO USE
+THE SOFTWARE (INCLUDING BUT NOT LIMITED TO LOSS OF DATA OR DATA BEING
+RENDERED INACCURATE OR LOSSES SUSTAINED BY YOU OR THIRD PARTIES OR A
+FAILURE OF THE SOFTWARE TO OPERATE WITH ANY OTHER SOFTWARE), EVEN IF
+SUCH HOLDER OR OTHER PARTY HAS BEEN ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGES.
+
+=cut
+
+1;
+__END__
@@ -1,13 +1,18 @@
 #!/usr/bin/env perl
 
-use Test::More tests => 5;
+use Test::More tests => 10;
 
 BEGIN {
 	use_ok('Svsh') || print "Bail out Svsh!\n";
 	use_ok('Svsh::Perp') || print "Bail out Svsh::Perp!\n";
 	use_ok('Svsh::S6') || print "Bail out Svsh::S6!\n";
+	use_ok('Svsh::S6rc') || print "Bail out Svsh::S6rc!\n";
 	use_ok('Svsh::Runit') || print "Bail out Svsh::Runit!\n";
 	use_ok('Svsh::Daemontools') || print "Bail out Svsh::Daemontools!\n";
+	use_ok('Svsh::Systemd') || print "Bail out Svsh::Systemd!\n";
+	use_ok('Svsh::Openrc') || print "Bail out Svsh::Openrc!\n";
+	use_ok('Svsh::Nosh') || print "Bail out Svsh::Nosh!\n";
+	use_ok('Svsh::Dinit') || print "Bail out Svsh::Dinit!\n";
 }
 
 diag("Testing Svsh $Svsh::VERSION, Perl $], $^X");
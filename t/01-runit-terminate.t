@@ -0,0 +1,21 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 4;
+
+use Svsh::Runit;
+
+my $svsh = Svsh::Runit->new(basedir => '/etc/service');
+
+my @procs = (
+	{ pid => 1, argv => ['runit'] },
+	{ pid => 10, argv => ['runsvdir', '-P', '/etc/service', 'log: ...........'] },
+	{ pid => 11, argv => ['/usr/bin/runsvdir', '-P', '/etc/service-staging'] },
+	{ pid => 12, argv => ['runsv', 'staging'] },
+	{ pid => 13, argv => ['runsvdir', '/etc/service/staging/service/'] },
+	{ pid => 14, argv => ['vim', '/etc/service'] }
+);
+
+is_deeply([$svsh->_supervisor_pids('/etc/service', @procs)], [10], 'parent runsvdir matched exactly');
+is_deeply([$svsh->_supervisor_pids('/etc/service-staging', @procs)], [11], 'runsvdir with full path matched');
+is_deeply([$svsh->_supervisor_pids('/etc/service/staging/service', @procs)], [13], 'nested runsvdir matched, parent left alone');
+is_deeply([$svsh->_supervisor_pids('/etc/sv', @procs)], [], 'nothing matched for unsupervised directory');
@@ -0,0 +1,54 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 12;
+
+use File::Temp qw/tempdir/;
+use Svsh::Runit;
+
+my $basedir = tempdir(CLEANUP => 1);
+foreach ('my service', 'worker-1', 'worker-2', 'worker.x') {
+	mkdir "$basedir/$_";
+}
+open(my $fh, '>', "$basedir/my service/run");
+close $fh;
+
+my $svsh = Svsh::Runit->new(basedir => $basedir);
+
+is_deeply([$svsh->_service_dirs], ['my service', 'worker-1', 'worker-2', 'worker.x'], 'service with a space is listed');
+
+is($svsh->run_cmd('ls', "$basedir/my service"), "run\n", 'arguments with spaces are not re-split');
+
+is_deeply(
+	[$svsh->run_cmds((map { ['sh', '-c', "sleep 0.\$1; echo \$1", 'sh', $_] } 3, 1, 2), { concurrency => 2 })],
+	["3\n", "1\n", "2\n"],
+	'parallel commands return their outputs in order'
+);
+
+$svsh->_set_statuses({ map { $_ => {} } $svsh->_service_dirs });
+is_deeply([sort $svsh->expand_wildcards('worker-*')], ['worker-1', 'worker-2'], 'wildcards expand');
+is_deeply([sort $svsh->expand_wildcards('my*', 'worker.*')], ['my service', 'worker.x'], 'wildcards are not regular expressions');
+
+is_deeply([sort $svsh->expand_wildcards('worker-?')], ['worker-1', 'worker-2'], 'question marks match one character');
+is(eval { $svsh->expand_wildcards('wrker*') } || $@, "No services match wrker*\n", 'wildcards matching nothing die');
+
+is_deeply([$svsh->expand_wildcards('worker[1-2]')], ['worker-1', 'worker-2'], 'numbered ranges expand');
+ok(!eval { $svsh->expand_wildcards('worker[1-3]') }, 'ranges with missing members die');
+
+{
+	local $ENV{LANG} = 'de_DE.UTF-8';
+	local $ENV{LC_ALL} = 'de_DE.UTF-8';
+	is($svsh->run_cmd('sh', '-c', 'echo $LC_ALL'), "C\n", 'tools run in the C locale');
+}
+
+mkdir "$basedir/caf\xc3\xa9";
+ok((grep { $_ eq "caf\xc3\xa9" } $svsh->_service_dirs), 'non-ASCII service names are listed');
+
+is_deeply($svsh->collapse_statuses({
+	'worker-1' => { status => 'up', duration => 5, pid => 1 },
+	'worker-2' => { status => 'up', duration => 9, pid => 2 },
+	'worker-3' => { status => 'down', duration => 1, pid => '-' },
+	'db' => { status => 'up', duration => 3, pid => 4 }
+}), {
+	worker => { status => '1 down, 2 up', duration => 9, pid => '-', supervise_pid => '-' },
+	db => { status => 'up', duration => 3, pid => 4 }
+}, 'numbered services collapse');
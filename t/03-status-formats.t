@@ -0,0 +1,69 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 13;
+
+use File::Temp qw/tempdir/;
+use JSON::PP;
+
+# a fake runit installation, with one service up and one down
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh <<'SV';
+#!/bin/sh
+case "$2" in
+	*/web) echo "run: $2: (pid 123) 45s; run: log: (pid 122) 45s";;
+	*) echo "down: $2: 3s, normally up";;
+esac
+SV
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('api', 'web');
+
+sub svsh {
+	open(my $out, '-|', $^X, 'bin/svsh', '-s', 'runit', '-d', $basedir, '-b', $bindir, @_)
+		|| die "Can't run svsh: $!";
+	local $/;
+	return <$out>;
+}
+
+sub status { svsh('status', @_) }
+
+my $json = decode_json(status('--format', 'json'));
+is_deeply($json, [
+	{ name => 'api', status => 'down', duration => 3, pid => undef, want => 'down' },
+	{ name => 'web', status => 'up', duration => 45, pid => 123, want => 'up', log => 'up', log_pid => 122 }
+], 'json format');
+
+is(status('--format', 'csv'), "name,status,duration,pid,want,log,log_pid\napi,down,3,,down,,\nweb,up,45,123,up,up,122\n", 'csv format has a header row');
+
+is(status('--format', 'yaml'), <<'YAML', 'yaml format shares the json fields');
+- name: "api"
+  status: "down"
+  duration: 3
+  pid: null
+  want: "down"
+- name: "web"
+  status: "up"
+  duration: 45
+  pid: 123
+  log: "up"
+  log_pid: 122
+  want: "up"
+YAML
+
+like(status('--format', 'xml'), qr/^Unknown format xml/, 'unknown formats are rejected');
+
+is_deeply([map { $_->{name} } @{decode_json(status('--format', 'json', 'we'))}], ['web'], 'status is filtered by substring');
+is_deeply([map { $_->{name} } @{decode_json(status('--format', 'json', '-r', '^(api|db)$'))}], ['api'], 'status is filtered by regex');
+
+is_deeply([map { $_->{name} } @{decode_json(status('--format', 'json', '--sort', 'duration', '--reverse'))}], ['web', 'api'], 'status is sorted by duration, reversed');
+is_deeply([map { $_->{name} } @{decode_json(status('--format', 'json', '--sort', 'pid'))}], ['api', 'web'], 'services without a pid sort first');
+is_deeply([map { $_->{name} } @{decode_json(status('--format', 'json', 'web', 'api'))}], ['api', 'web'], 'status lists the provided services');
+like(status('--sort', 'color'), qr/^Unknown sort key color/, 'unknown sort keys are rejected');
+
+unlike(status('--format', 'table'), qr/\e\[/, 'tables are printed without colors when piped');
+
+is(svsh('services'), "api\nweb\n", 'services lists service names');
+is(svsh('services', '--down'), "api\n", 'services are filtered by state');
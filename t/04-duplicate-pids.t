@@ -0,0 +1,28 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 3;
+
+use File::Temp qw/tempdir/;
+use Svsh::Runit;
+
+# a fake runit installation, where two services report the same pid
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh <<'SV';
+#!/bin/sh
+case "$2" in
+	*/db) echo "run: $2: (pid 456) 10s";;
+	*) echo "run: $2: (pid 123) 45s";;
+esac
+SV
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('db', 'web', 'web-copy');
+
+my $statuses = Svsh::Runit->new(basedir => $basedir, bindir => $bindir)->status;
+
+ok($statuses->{web}->{duplicate_pid}, 'service sharing a pid is flagged');
+ok($statuses->{'web-copy'}->{duplicate_pid}, 'all services sharing a pid are flagged');
+ok(!$statuses->{db}->{duplicate_pid}, 'service with its own pid is not flagged');
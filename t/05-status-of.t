@@ -0,0 +1,30 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 3;
+
+use File::Temp qw/tempdir/;
+use Svsh::Runit;
+
+# a fake runit installation, recording the services it's asked about
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh <<"SV";
+#!/bin/sh
+echo "\$2" >> $bindir/asked
+echo "run: \$2: (pid 123) 45s"
+SV
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('api', 'web');
+
+my $svsh = Svsh::Runit->new(basedir => $basedir, bindir => $bindir);
+
+is_deeply($svsh->status_of('web'), { status => 'up', want => 'up', duration => 45, pid => 123 }, 'status of one service');
+
+open($fh, '<', "$bindir/asked");
+is_deeply([<$fh>], ["$basedir/web\n"], 'only that service is queried');
+close $fh;
+
+ok(!eval { $svsh->status_of('db') } && $@ =~ m/^No such service/, 'missing services die with a distinct error');
@@ -0,0 +1,48 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 2;
+
+use File::Temp qw/tempdir/;
+use Svsh::Runit;
+
+# a fake lsof, describing an svlogd process writing to a log
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/lsof");
+print $fh <<'LSOF';
+#!/bin/sh
+cat <<OUT
+p321
+fcwd
+n/var/log/web
+ftxt
+n/usr/bin/svlogd
+ftxt
+n/lib/libc.so.7
+f0r
+npipe
+f3w
+n/var/log/web/lock
+f4w
+n/var/log/web/current
+OUT
+LSOF
+close $fh;
+chmod 0755, "$bindir/lsof";
+
+$ENV{PATH} = "$bindir:$ENV{PATH}";
+
+my $svsh = Svsh::Runit->new(basedir => $bindir);
+
+{
+	no warnings 'redefine';
+	*Svsh::Runit::_has_proc = sub { 0 };
+}
+
+is($svsh->find_logfile(321), '/var/log/web/current', 'log file found with lsof');
+
+{
+	no warnings 'redefine';
+	*Svsh::Runit::_lsof_files = sub { ('/usr/bin/nginx', '/var/log/web/current') };
+}
+
+ok(!defined $svsh->find_logfile(321), 'files of non-logging programs are ignored');
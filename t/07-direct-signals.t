@@ -0,0 +1,61 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 5;
+
+use Config;
+use File::Temp qw/tempdir/;
+use Svsh::Runit;
+
+my %numbers;
+@numbers{split(/ /, $Config{sig_name})} = split(/ /, $Config{sig_num});
+
+# a fake runit installation, with a service whose pid is read
+# from a file, and which records the commands it's given
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh <<"SV";
+#!/bin/sh
+if [ "\$1" = status ]; then
+	echo "run: \$2: (pid `cat $bindir/pid`) 45s"
+else
+	echo "\$*" >> $bindir/sent
+fi
+SV
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/worker";
+
+my $svsh = Svsh::Runit->new(basedir => $basedir, bindir => $bindir);
+
+# signals the process with $signal, returning the signal it died of
+sub signalled {
+	my $signal = shift;
+
+	my $pid = fork // die "Can't fork: $!";
+	unless ($pid) {
+		sleep 30;
+		exit 0;
+	}
+
+	open(my $fh, '>', "$bindir/pid");
+	print $fh $pid;
+	close $fh;
+
+	$svsh->signal(undef, { args => [$signal, 'worker'] });
+	waitpid($pid, 0);
+
+	return $? & 127;
+}
+
+is(signalled('15'), 15, 'signal numbers are sent directly');
+is(signalled('sigrtmin+1'), $numbers{RTMIN} + 1, 'offsets from RTMIN are sent directly');
+is(signalled('RTMAX-1'), $numbers{RTMAX} - 1, 'offsets from RTMAX are sent directly');
+
+$svsh->signal(undef, { args => ['usr1', 'worker'] });
+open($fh, '<', "$bindir/sent");
+is_deeply([<$fh>], ["1 $basedir/worker\n"], 'supported signals are sent by the supervisor');
+close $fh;
+
+ok(!eval { $svsh->signal(undef, { args => ['RTMIN+1000', 'worker'] }) } && $@ =~ m/does not support/, 'unknown signals are rejected');
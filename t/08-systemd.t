@@ -0,0 +1,45 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 5;
+
+use File::Temp qw/tempdir/;
+use Svsh::Systemd;
+
+# a fake systemctl, with units in various states
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/systemctl");
+print $fh <<'SYSTEMCTL';
+#!/bin/sh
+up=$(awk '{print int($1)}' /proc/uptime)
+case "$1" in
+list-units)
+	echo "nginx.service loaded active running Nginx"
+	echo "cron.service loaded failed failed Cron"
+	echo "worker.service loaded activating auto-restart Worker"
+	echo "dbus.socket loaded active listening D-Bus Socket"
+	;;
+show)
+	for unit in "$@"; do
+		case "$unit" in
+		nginx.service) printf 'Id=nginx.service\nActiveState=active\nMainPID=321\nActiveEnterTimestampMonotonic=%s000000\n\n' $((up - 45));;
+		cron.service) printf 'Id=cron.service\nActiveState=failed\nMainPID=0\nInactiveEnterTimestampMonotonic=%s000000\n\n' $((up - 10));;
+		worker.service) printf 'Id=worker.service\nActiveState=activating\nMainPID=0\n\n';;
+		esac
+	done
+	;;
+esac
+SYSTEMCTL
+close $fh;
+chmod 0755, "$bindir/systemctl";
+
+$ENV{PATH} = "$bindir:$ENV{PATH}";
+
+my $svsh = Svsh::Systemd->new(basedir => $bindir);
+my $statuses = $svsh->status;
+
+is_deeply([sort keys %$statuses], [qw/cron nginx worker/], 'only service units are listed');
+is($statuses->{nginx}->{status}, 'up', 'active services are up');
+is($statuses->{cron}->{status}, 'down', 'failed services are down');
+is($statuses->{worker}->{status}, 'backoff', 'activating services are in backoff');
+
+ok(abs($svsh->status_of('nginx')->{duration} - 45) <= 1 && $svsh->status_of('nginx')->{pid} == 321, 'duration and pid of a service');
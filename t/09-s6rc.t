@@ -0,0 +1,48 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 4;
+
+use File::Temp qw/tempdir/;
+use Svsh::S6rc;
+
+# a fake s6-rc installation, with a longrun and two oneshots
+# (only one of them active)
+my $bindir = tempdir(CLEANUP => 1);
+my %tools = (
+	's6-rc-db' => <<'TOOL',
+#!/bin/sh
+case "$2" in
+	longruns) echo nginx;;
+	oneshots) printf 'mount-tmp\nsetup\n';;
+esac
+TOOL
+	's6-rc' => <<'TOOL',
+#!/bin/sh
+printf 'nginx\nsetup\n'
+TOOL
+	's6-svstat' => <<'TOOL'
+#!/bin/sh
+echo "up (pid 77) 12 seconds"
+TOOL
+);
+foreach (keys %tools) {
+	open(my $fh, '>', "$bindir/$_");
+	print $fh $tools{$_};
+	close $fh;
+	chmod 0755, "$bindir/$_";
+}
+
+my $basedir = tempdir(CLEANUP => 1);
+
+my $svsh = Svsh::S6rc->new(basedir => $basedir, bindir => $bindir);
+
+is_deeply($svsh->status, {
+	nginx => { status => 'up', want => 'up', duration => 12, pid => 77 },
+	setup => { status => 'up', duration => 0, pid => '-' },
+	'mount-tmp' => { status => 'down', duration => 0, pid => '-' }
+}, 'longruns and oneshots are listed');
+
+is($svsh->status_of('mount-tmp')->{status}, 'down', 'status of an inactive oneshot');
+
+ok(!eval { $svsh->signal(undef, { args => ['hup', 'setup'] }) } && $@ =~ m/not a longrun/, 'oneshots can\'t be signalled');
+ok(!eval { $svsh->fg(undef, { args => ['setup'] }) } && $@ =~ m/not a longrun/, 'oneshots have no log to follow');
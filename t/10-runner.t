@@ -0,0 +1,160 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 25;
+
+use File::Temp qw/tempdir/;
+use POSIX ();
+use Svsh::Runit;
+use Svsh::S6;
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('api', 'db', 'web', 'worker');
+
+# canned outputs of the status tools, by service
+my %sv = (
+	api => "down: $basedir/api: 3s, normally up\n",
+	db => "down: $basedir/db: 0s, normally up, want up\n",
+	web => "run: $basedir/web: (pid 123) 45s; run: log: (pid 122) 45s\n",
+	worker => "warning: $basedir/worker: unable to open supervise/ok: file does not exist\n"
+);
+my %s6svstat = (
+	api => "down (exitcode 0) 3 seconds, normally up, ready 3 seconds\n",
+	db => "down (exitcode 1) 0 seconds, normally up, want up\n",
+	web => "up (pid 123) 45 seconds\n",
+	worker => "s6-svstat: fatal: unable to read status for $basedir/worker: No such file or directory\n"
+);
+
+my @commands;
+my $runit = Svsh::Runit->new(basedir => $basedir, runner => sub {
+	push(@commands, [@_]);
+	return $sv{(split(/\//, $_[2]))[-1]};
+});
+
+is_deeply($runit->status, {
+	api => { status => 'down', want => 'down', duration => 3, pid => '-' },
+	db => { status => 'down', want => 'up', duration => 0, pid => '-' },
+	web => { status => 'up', want => 'up', duration => 45, pid => 123, log => 'up', log_pid => 122 },
+	worker => { status => 'unknown', duration => 0, pid => '-', parse_error => 1 }
+}, 'sv status output is parsed');
+
+is_deeply([sort { $a->[2] cmp $b->[2] } @commands], [map { ['sv', 'status', "$basedir/$_"] } ('api', 'db', 'web', 'worker')], 'sv status is run for every service');
+
+@commands = ();
+$runit->statuses_of('web', 'db');
+is_deeply([sort { $a->[2] cmp $b->[2] } @commands], [map { ['sv', 'status', "$basedir/$_"] } ('db', 'web')], 'only the requested services are queried');
+ok(!eval { $runit->statuses_of('web', 'ghost') } && $@ =~ m/^No such service: ghost/, 'services that do not exist are rejected before querying');
+
+my $s6 = Svsh::S6->new(basedir => $basedir, runner => sub { $s6svstat{(split(/\//, $_[1]))[-1]} });
+
+is_deeply($s6->status, {
+	api => { status => 'down', want => 'down', duration => 3, pid => '-' },
+	db => { status => 'down', want => 'up', duration => 0, pid => '-' },
+	web => { status => 'up', want => 'up', duration => 45, pid => 123 },
+	worker => { status => 'unknown', duration => 0, pid => '-', parse_error => 1 }
+}, 's6-svstat output is parsed');
+
+is_deeply($s6->status_of('web'), { status => 'up', want => 'up', duration => 45, pid => 123 }, 'status of one service');
+
+# the death tally, read by s6-svdt, counts restarts
+my $tallied = Svsh::S6->new(basedir => $basedir, runner => sub {
+	return $_[0] eq 's6-svdt' ?
+		join('', map { "\@40000000652f0b1$_ exitcode 1\n" } (1 .. 3)) :
+		$s6svstat{db};
+});
+
+is($tallied->status_of('db')->{restarts}, 3, 'restarts are counted from the death tally');
+
+# the loggers of services with a log subdirectory are queried too
+my $logged = tempdir(CLEANUP => 1);
+mkdir "$logged/$_" foreach ('web', 'web/log');
+my $s6log = Svsh::S6->new(basedir => $logged, runner => sub {
+	return $_[0] eq 's6-svdt' ? '' : $_[1] =~ m!/log$! ? "down (signal SIGKILL) 2 seconds, normally up, want up\n" : $s6svstat{web};
+});
+is_deeply($s6log->status->{web}, { status => 'up', want => 'up', duration => 45, pid => 123, restarts => 0, log => 'down', log_pid => '-' }, 'the status of the logger is added');
+
+# restarting takes services down and up again, rather than sending a QUIT
+my @s6svc;
+my $restarter = Svsh::S6->new(basedir => $basedir, runner => sub { push(@s6svc, [@_]); '' });
+$restarter->restart(undef, { args => ['web'] });
+is_deeply(\@s6svc, [['s6-svc', '-ru', "$basedir/web"]], 'restart sends s6-svc -ru');
+
+@s6svc = ();
+$restarter->restart(undef, { args => ['web'], wait => 2 });
+is_deeply(\@s6svc, [['s6-svc', '-wR', '-T', 2000, '-ru', "$basedir/web"]], 'restart waits for the services to be ready');
+
+# s6-svc isn't told to wait when resetting or killing, so those are polled
+is_deeply([grep { $restarter->native_wait($_) } qw/start stop restart once reset force_stop/], [qw/start stop restart once/], 'reset and kill fall back to polling');
+
+# stop_wait kills services which don't stop, and reports those that
+# refuse to die as well: api only goes down once killed, web never does
+my %killed;
+my $stubborn = Svsh::Runit->new(basedir => $basedir, runner => sub {
+	my ($action) = grep { m/^(status|down|kill)$/ } @_;
+	my $sv = (split(/\//, $_[-1]))[-1];
+	if ($action eq 'kill') {
+		$killed{(split(/\//, $_))[-1]} = 1 foreach grep { m!/! } @_;
+		return '';
+	}
+	return '' unless $action eq 'status';
+	return $sv eq 'web' || ($sv eq 'api' && !$killed{api}) ? $sv{web} : $sv{api};
+});
+
+local $Svsh::KILL_TIMEOUT = 0;
+eval { $stubborn->stop_wait(undef, 0, 'api', 'web') };
+is($@, "Services refused to stop: web\n", 'services that refuse to stop are reported');
+is_deeply([sort keys %killed], ['api', 'web'], 'services that did not stop in time are killed');
+
+# in dry-run mode, commands changing services are only printed, while
+# status queries still run
+@commands = ();
+$runit->dry_run(1);
+is($runit->stop(undef, { args => ['my api', 'web'] }), "Would run: sv down '$basedir/my api' $basedir/web\n", 'dry-run prints the command line');
+is($runit->status_of('web')->{status}, 'up', 'dry-run still queries statuses');
+
+# the logger traces every command, with its exit status and output
+my @trace;
+my $traced = Svsh::Runit->new(basedir => $basedir, debug => 1, logger => sub { push(@trace, @_) });
+$traced->run_cmd('sh', '-c', 'echo "not  running"; exit 3');
+is_deeply(\@trace, ["sh -c 'echo \"not  running\"; exit 3' (exit 3): not running\n"], 'commands are traced');
+@trace = ();
+$traced->run_cmd('echo', "it's");
+is_deeply(\@trace, ["echo 'it'\\''s' (exit 0): it's\n"], 'traces are quoted like the commands that run');
+$traced->debug(0);
+$traced->run_cmd('true');
+is(scalar @trace, 1, 'commands are only traced in debug mode');
+
+# statuses are cached for completion until they expire or are refreshed
+my $queries = 0;
+my $cached = Svsh::S6->new(basedir => $basedir, status_ttl => 60, runner => sub { $queries++; $s6svstat{(split(/\//, $_[1]))[-1]} });
+$cached->status;
+my $per_status = $queries;
+$cached->cached_status;
+is($queries, $per_status, 'cached statuses are reused');
+$cached->refresh;
+$cached->cached_status;
+is($queries, 2 * $per_status, 'refreshed statuses are read again');
+
+# kept statuses outlive status_ttl, until refreshed
+my $kept = Svsh::S6->new(basedir => $basedir, status_ttl => 0.01, runner => sub { $queries++; $s6svstat{(split(/\//, $_[1]))[-1]} });
+$queries = 0;
+$kept->status;
+$kept->keep_status;
+select(undef, undef, undef, 0.05);
+$kept->cached_status;
+is($queries, $per_status, 'kept statuses are reused after status_ttl');
+$kept->refresh;
+$kept->cached_status;
+select(undef, undef, undef, 0.05);
+$kept->cached_status;
+is($queries, 3 * $per_status, 'refreshed statuses expire again');
+
+# control characters are written to the control FIFO of services
+my $supervised = tempdir(CLEANUP => 1);
+mkdir "$supervised/$_" foreach ('web', 'web/supervise', 'api', 'api/supervise');
+POSIX::mkfifo("$supervised/web/supervise/control", 0600);
+sysopen(my $control, "$supervised/web/supervise/control", POSIX::O_RDONLY() | POSIX::O_NONBLOCK());
+my $controlled = Svsh::Runit->new(basedir => $supervised);
+like($controlled->control('x', 'api', 'web'), qr/^Can't write to the control FIFO of api/, 'unsupervised services are reported');
+sysread($control, my $written, 8);
+is($written, 'x', 'the control character is written');
+ok(!eval { $controlled->control('z', 'web') } && $@ =~ m/valid characters are: u d o/, 'unknown control characters are rejected');
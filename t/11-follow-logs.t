@@ -0,0 +1,78 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 11;
+
+use File::Temp qw/tempdir/;
+use POSIX ();
+use Svsh::Runit;
+
+my $logdir = tempdir(CLEANUP => 1);
+foreach ('api', 'web') {
+	open(my $fh, '>', "$logdir/$_");
+	print $fh "$_ started\n";
+	close $fh;
+}
+
+my $svsh = Svsh::Runit->new(basedir => $logdir);
+
+# follows the log files until a line was read from every one
+# of them (or a few seconds passed), returning these lines
+sub follow {
+	my ($logfiles, $options) = @_;
+
+	my $output = '';
+	open(my $out, '>', \$output);
+	my $deadline = time + 5;
+	$svsh->follow_logs($logfiles, {
+		%{$options || {}},
+		out => $out,
+		cancel => sub { time > $deadline || (() = $output =~ m/\n/g) >= scalar keys %$logfiles }
+	});
+	close $out;
+
+	return [sort split(/\n/, $output)];
+}
+
+is_deeply(follow({ api => "$logdir/api", web => "$logdir/web" }), ['[api] api started', '[web] web started'], 'lines of several logs are prefixed');
+is_deeply(follow({ api => "$logdir/api" }), ['api started'], 'lines of a single log are not prefixed');
+
+# prefixes are padded to the longest name, and long names truncated
+foreach ('scheduler', 'a-very-long-service-name') {
+	open(my $fh, '>', "$logdir/$_");
+	print $fh "started\n";
+	close $fh;
+}
+is_deeply(follow({ api => "$logdir/api", scheduler => "$logdir/scheduler" }), ['[api]       api started', '[scheduler] started'], 'prefixes are aligned');
+is_deeply(follow({ api => "$logdir/api", 'a-very-long-service-name' => "$logdir/a-very-long-service-name" }),
+	["[a-very-long-ser\xe2\x80\xa6] started", '[api]              api started'], 'long names are truncated');
+
+# logs reads the end of the log file found by the adapter
+open(my $fh, '>>', "$logdir/web");
+print $fh "web line $_\n" foreach (1 .. 3);
+close $fh;
+{
+	no warnings 'redefine';
+	*Svsh::Runit::logfile = sub { "$logdir/$_[1]" };
+}
+
+is_deeply([$svsh->logs('web', 2)], ["web line 2\n", "web line 3\n"], 'last lines of a log');
+
+# durations and TAI64N labels
+is($svsh->parse_duration('1h30m'), 5400, 'durations are parsed');
+ok(!defined $svsh->parse_duration('30m1h'), 'units must be in order');
+
+my $now = time;
+sub label { sprintf('@%08x%08x%08x', 0x40000000, $_[0] + 10, 0) }
+is(int($svsh->decode_tai64n(label($now))), $now, 'TAI64N labels are decoded');
+
+# only lines logged within the duration are followed
+open($fh, '>', "$logdir/worker");
+printf $fh "%s %s\n", label($now - $_ * 60), "$_ minutes ago" foreach (30, 5);
+close $fh;
+my $recent = follow({ worker => "$logdir/worker" }, { since => 600 });
+is_deeply([map { s/^\S+ //r } @$recent], ['5 minutes ago'], 'lines are followed since a time');
+
+# TAI64N labels are replaced with local times, other lines are left alone
+my $human = POSIX::strftime('%Y-%m-%d %H:%M:%S', localtime $now).'.000';
+is($svsh->humanize_tai64n(label($now)." worker started\n"), "$human worker started\n", 'labels are humanized');
+is($svsh->humanize_tai64n("worker started\n"), "worker started\n", 'lines without labels pass through');
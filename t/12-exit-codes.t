@@ -0,0 +1,89 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 20;
+
+use File::Temp qw/tempdir/;
+
+# a fake runit installation, where web is up and api won't come up
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh <<'SV';
+#!/bin/sh
+for last; do :; done
+case "$1" in
+	status) ;;
+	*) exit 0;;
+esac
+case "$last" in
+	*/web) echo "run: $last: (pid 123) 45s";;
+	*) echo "down: $last: 3s, normally up";;
+esac
+SV
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('api', 'web');
+
+sub svsh {
+	open(my $out, '-|', $^X, 'bin/svsh', '-s', 'runit', '-d', $basedir, '-b', $bindir, @_)
+		|| die "Can't run svsh: $!";
+	local $/;
+	my $output = <$out>;
+	close $out;
+	return ($? >> 8, $output);
+}
+
+my ($code, $output) = svsh('start', 'web', 'ghost', 'phantom');
+is($code, 2, 'the exit code is the number of failed services');
+like($output, qr/^2 of 3 services failed: ghost, phantom$/m, 'failed services are summarized');
+
+($code, $output) = svsh('start', '--wait', '--op-timeout', '0.1', 'api', 'web');
+is($code, 1, 'services that do not come up in time fail');
+
+($code) = svsh('start', 'web');
+is($code, 0, 'the exit code is zero when all services succeed');
+
+($code, $output) = svsh('check');
+is($code, 1, 'check fails when a service is down');
+like($output, qr/^  api: down$/m, 'check lists the services that are down');
+
+# api was stopped, its supervisor wants it down
+($code) = svsh('check', '--want-up');
+is($code, 0, 'check --want-up ignores services wanted down');
+
+# api doesn't come back up, so the rolling restart stops before web
+($code, $output) = svsh('restart', '--stagger', '0', '--op-timeout', '0.1', 'web', 'api');
+like($output, qr/^Stopping the rolling restart, not restarting: web$/m, 'rolling restarts stop when a service does not come back up');
+is($code, 2, 'services not restarted count as failed');
+
+# there's no one to confirm one-shot terminations
+($code, $output) = svsh('terminate');
+is($code, 1, 'terminate fails without confirmation');
+like($output, qr/^Not terminating without confirmation/m, 'terminate asks for --force');
+
+# web is up and api is down
+my $desired = File::Temp->new;
+print $desired "# desired state\nweb: up\napi: up\n\nghost: down\n";
+close $desired;
+
+($code, $output) = svsh('diff', "$desired");
+is($code, 1, 'diff fails when services differ from the file');
+like($output, qr/^  api: down, expected up$/m, 'diff lists services in another state');
+like($output, qr/^  ghost: no such service, expected down$/m, 'diff lists services that do not exist');
+unlike($output, qr/^  web:/m, 'diff does not list services as expected');
+
+($code) = svsh('wait', 'up', 'web');
+is($code, 0, 'wait succeeds when services reach the state');
+
+($code, $output) = svsh('wait', '--timeout', '0.2', '--interval', '0.1', 'up', 'api', 'web');
+is($code, 1, 'wait fails when services time out');
+like($output, qr/^Timed out waiting for services to be up: api$/m, 'wait lists services that time out');
+
+# snapshots are recorded and read back with non-ASCII service names
+mkdir "$basedir/caf\xc3\xa9";
+my $history = File::Temp->new;
+svsh('--history-file', "$history", 'status');
+($code, $output) = svsh('--history-file', "$history", 'history', "caf\xc3\xa9");
+like($output, qr/^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d  down$/m, 'the history of non-ASCII service names is shown');
+unlike($output, qr/^No history/m, 'snapshots with non-ASCII service names are read');
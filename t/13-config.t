@@ -0,0 +1,86 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 14;
+
+use File::Temp qw/tempdir/;
+
+# a fake runit installation, with two base directories
+my $bindir = tempdir(CLEANUP => 1);
+open(my $fh, '>', "$bindir/sv");
+print $fh "#!/bin/sh\n";
+close $fh;
+chmod 0755, "$bindir/sv";
+
+my ($etc, $var) = (tempdir(CLEANUP => 1), tempdir(CLEANUP => 1));
+
+# the home directory, where ~/.svshrc is looked for
+local $ENV{HOME} = tempdir(CLEANUP => 1);
+delete @ENV{'SVSH_SUITE', 'SVSH_BASE'};
+
+sub write_config {
+	my ($file, $content) = @_;
+	open(my $fh, '>', $file) || die "Can't write $file: $!";
+	print $fh $content;
+	close $fh;
+}
+
+sub config {
+	open(my $out, '-|', $^X, 'bin/svsh', @_, 'export', '--config')
+		|| die "Can't run svsh: $!";
+	local $/;
+	my %config = map { m/^(\w+) = (.*)$/ } split(/\n/, <$out>);
+	return \%config;
+}
+
+write_config("$ENV{HOME}/.svshrc", "# defaults\nsuite = runit\nbasedir = $etc\n\nbindir = $bindir\ncollapse = 1\n");
+
+my $config = config();
+is_deeply([@$config{'suite', 'basedir', 'bindir', 'collapse'}], ['runit', $etc, $bindir, 1], '~/.svshrc provides defaults');
+
+is(config('-d', $var)->{basedir}, $var, 'command line options override the configuration file');
+
+{
+	local $ENV{SVSH_BASE} = $var;
+	is(config()->{basedir}, $var, 'environment variables override the configuration file');
+	is(config('-d', $etc)->{basedir}, $etc, 'command line options override environment variables');
+}
+
+write_config("$ENV{HOME}/custom", "suite = runit\nbasedir = $var\nbindir = $bindir\n");
+is(config('--config', "$ENV{HOME}/custom")->{basedir}, $var, '--config reads a custom file');
+
+# groups are expanded to their services, wherever services are expected
+write_config("$ENV{HOME}/groups", "suite = runit\nbasedir = $var\nbindir = $bindir\n\n[groups]\nfrontend = web, api\nall = *\n");
+mkdir "$var/$_" foreach ('api', 'db', 'web');
+
+sub dry_run {
+	open(my $out, '-|', $^X, 'bin/svsh', '--config', "$ENV{HOME}/groups", '-n', @_)
+		|| die "Can't run svsh: $!";
+	local $/;
+	my $output = <$out>;
+	close $out;
+	return wantarray ? ($? >> 8, $output) : $output;
+}
+
+is(dry_run('stop', '@frontend', 'db'), "Would run: $bindir/sv down $var/api $var/db $var/web\n", 'groups are expanded');
+is(dry_run('start', '@all'), "Would run: $bindir/sv up $var/api $var/db $var/web\n", 'groups may hold wildcards');
+my ($code) = dry_run('stop', '@backend');
+is($code, 1, 'unknown groups are rejected');
+
+# services stopped persistently are disabled too
+is(dry_run('stop', '--persist', '@frontend'), "Would run: touch $var/api/down $var/web/down\nWould run: $bindir/sv down $var/api $var/web\n", 'stop --persist creates down files');
+
+# the shell history is configurable too
+write_config("$ENV{HOME}/history", "suite = runit\nbasedir = $var\nbindir = $bindir\nshell_history = $ENV{HOME}/commands\nshell_history_size = 100\n");
+is(config('--config', "$ENV{HOME}/history")->{basedir}, $var, 'the shell history can be configured');
+
+# services outside the filters are never acted on
+is(dry_run('--exclude', 'd*', 'stop', '@all'), "Would run: $bindir/sv down $var/api $var/web\n", '--exclude hides services from wildcards');
+is(dry_run('--only', 'web', 'stop', 'api', 'web'), "Ignoring services outside --only/--exclude: api\nWould run: $bindir/sv down $var/web\n", '--only drops services named explicitly');
+
+# the environment variables of the suite's own tools come last
+write_config("$ENV{HOME}/nobase", "suite = runit\nbindir = $bindir\n");
+{
+	local $ENV{SVDIR} = $var;
+	is(config('--config', "$ENV{HOME}/nobase")->{basedir}, $var, 'SVDIR provides the default base directory of runit');
+	is(config('--config', "$ENV{HOME}/nobase", '-d', $etc)->{basedir}, $etc, 'command line options override SVDIR');
+}
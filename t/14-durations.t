@@ -0,0 +1,22 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 8;
+
+use Svsh::Runit;
+
+my $svsh = Svsh::Runit->new(basedir => '/service');
+
+my %durations = (
+	0 => '0s',
+	45 => '45s',
+	723 => '12m3s',
+	3600 => '1h',
+	18720 => '5h12m',
+	273600 => '3d4h',
+	1296000 => '2w1d',
+	1843200 => '3w'
+);
+
+foreach (sort { $a <=> $b } keys %durations) {
+	is($svsh->humanize_duration($_), $durations{$_}, "$_ seconds are $durations{$_}");
+}
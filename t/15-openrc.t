@@ -0,0 +1,43 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 10;
+
+use Svsh::Openrc;
+
+# canned output of rc-status, with services in various states
+my $rc_status = <<"RC";
+ sshd                                                       [  started  ]
+ nginx                                                      [  started 1 day(s) 02:03:04 (3)  ]
+ crond                                                      [  started 05:06 (1)  ]
+ postgresql                                                 [  crashed  ]
+ ntpd                                                       [  stopped  ]
+ \e[0;32mdbus\e[0m                                          [  stopped  ]
+ cups                                                       [  hotplugged  ]
+RC
+
+my @commands;
+my $svsh = Svsh::Openrc->new(basedir => '/etc/init.d', host => 'localhost', runner => sub {
+	push(@commands, [@_]);
+	return $_[0] eq 'rc-status' ? $rc_status : '';
+});
+
+my $statuses = $svsh->status;
+
+is_deeply($statuses->{nginx}, { status => 'up', duration => 93784, pid => '-', restarts => 2 }, 'uptime and restarts of supervised services');
+is_deeply($statuses->{crond}, { status => 'up', duration => 306, pid => '-', restarts => 0 }, 'uptimes shorter than an hour');
+is($statuses->{postgresql}->{status}, 'backoff', 'crashed services are in backoff');
+is($statuses->{dbus}->{status}, 'down', 'colors are ignored');
+ok($statuses->{cups}->{parse_error}, 'unknown states are not parsed');
+
+@commands = ();
+$svsh->restart(undef, { args => ['nginx', 'sshd'] });
+is_deeply([sort { $a->[1] cmp $b->[1] } grep { $_->[0] eq 'rc-service' } @commands], [['rc-service', 'nginx', 'restart'], ['rc-service', 'sshd', 'restart']], 'services are restarted one by one');
+
+# a few services are picked from a single status sweep, which
+# doesn't replace the statuses read by status()
+@commands = ();
+my $some = $svsh->statuses_of('nginx', 'sshd');
+is_deeply([sort keys %$some], ['nginx', 'sshd'], 'only the listed services are returned');
+is(scalar(grep { $_->[0] eq 'rc-status' } @commands), 1, 'rc-status runs once');
+is($svsh->statuses, $statuses, 'the statuses are left alone');
+ok(!eval { $svsh->statuses_of('ghost') } && $@ =~ m/^No such service: ghost/, 'services that do not exist are rejected');
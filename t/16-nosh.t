@@ -0,0 +1,27 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 5;
+
+use File::Temp qw/tempdir/;
+use Svsh::Nosh;
+
+my $basedir = tempdir(CLEANUP => 1);
+mkdir "$basedir/$_" foreach ('cron', 'dbus', 'ntpd', 'sshd', 'tty1');
+
+# canned outputs of service-status, by service
+my %status = (
+	ntpd => "$basedir/ntpd: running (pid 1234) 1h 2m 3s ago\n",
+	sshd => "$basedir/sshd: stopped 45s ago\n",
+	cron => "$basedir/cron: not present\n",
+	dbus => "$basedir/dbus: stopped 3s ago, wants to run but can't\n",
+	tty1 => "service-status: FATAL: $basedir/tty1: No such file or directory\n"
+);
+
+my $svsh = Svsh::Nosh->new(basedir => $basedir, runner => sub { $status{(split(/\//, $_[1]))[-1]} });
+my $statuses = $svsh->status;
+
+is_deeply($statuses->{ntpd}, { status => 'up', duration => 3723, pid => 1234 }, 'running services are up');
+is_deeply($statuses->{sshd}, { status => 'down', duration => 45, pid => '-' }, 'stopped services are down');
+is($statuses->{cron}->{status}, 'disabled', 'services not present are disabled');
+is($statuses->{dbus}->{status}, 'backoff', 'services that want to run but can\'t are in backoff');
+ok($statuses->{tty1}->{parse_error}, 'errors are not parsed');
@@ -0,0 +1,33 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 9;
+
+use Svsh::Runit;
+
+my $svsh = Svsh::Runit->new(basedir => '/etc/service');
+
+# real sv status outputs, and how they are parsed
+my @cases = (
+	["run: /etc/service/web: (pid 123) 45s; run: log: (pid 122) 45s\n",
+		{ status => 'up', want => 'up', duration => 45, pid => 123, log => 'up', log_pid => 122 }, 'running service with a logger'],
+	["down: /etc/service/web: 3s, normally up\n",
+		{ status => 'down', want => 'down', duration => 3, pid => '-' }, 'down, normally up'],
+	["down: /etc/service/web: 0s, normally up, want up\n",
+		{ status => 'down', want => 'up', duration => 0, pid => '-' }, 'down, wanted up'],
+	["run: /etc/service/web: (pid 123) 5s, normally down, want down, got TERM\n",
+		{ status => 'up', want => 'down', duration => 5, pid => 123 }, 'stopping, with every suffix'],
+	["run: /etc/service/web: (pid 123) 5s, paused\n",
+		{ status => 'up', want => 'up', duration => 5, pid => 123 }, 'paused'],
+	["finish: /etc/service/web: (pid 124) 1s\n",
+		{ status => 'finish', want => '-', duration => 1, pid => 124 }, 'running the finish script'],
+	["run: /srv/svc:2/web:8080: (pid 123) 45s; down: log: 1s, want down\n",
+		{ status => 'up', want => 'up', duration => 45, pid => 123, log => 'down', log_pid => '-' }, 'colons in the directory, with a dead logger'],
+	["down: /etc/service/my web: 3s\n",
+		{ status => 'down', want => 'down', duration => 3, pid => '-' }, 'spaces in the name']
+);
+
+is_deeply($svsh->_parse_status('web', $_->[0]), $_->[1], $_->[2])
+	foreach @cases;
+
+my $unparsed = $svsh->_parse_status('web', "warning: /etc/service/web: unable to open supervise/ok: file does not exist\n");
+ok($unparsed->{parse_error}, 'warnings are not parsed');
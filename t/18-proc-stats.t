@@ -0,0 +1,22 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 4;
+
+use Svsh::Runit;
+
+my $svsh = Svsh::Runit->new(basedir => '/etc/service');
+
+# the usage of this very process is read from /proc (or ps)
+my $stats = $svsh->proc_stats($$);
+ok($stats->{rss} > 0, 'resident memory is read');
+ok($stats->{cpu} >= 0, 'cpu time is read');
+
+# ps reports CPU times in [[days-]hours:]minutes:seconds
+{
+	no warnings 'redefine';
+	local *Svsh::Runit::_has_proc = sub { 0 };
+	my $ps = Svsh::Runit->new(basedir => '/etc/service', runner => sub { "  2048 1-02:03:04\n" });
+	is_deeply($ps->proc_stats(123), { cpu => 93784, rss => 2048 }, 'usage is read from ps without /proc');
+}
+
+ok(!defined $svsh->proc_stats(999999999), 'missing processes have no usage');
@@ -0,0 +1,27 @@
+#!/usr/bin/env perl
+
+use Test::More tests => 7;
+
+use Svsh::Dinit;
+
+# a canned output of dinitctl list
+my $list = <<'LIST';
+[[+]     ] boot
+[{+}     ] sshd (pid: 1234)
+[{ }<<   ] mysql
+[   >>{ }] nginx (pid: 99)
+[     {X}] cron (exit status: 1)
+[     [-]] tty1
+LIST
+
+my $svsh = Svsh::Dinit->new(basedir => '/etc/dinit.d', runner => sub { $_[1] eq '--version' ? "Dinit version 0.17.1.\n" : $list });
+my $statuses = $svsh->status;
+
+is_deeply($statuses->{sshd}, { status => 'up', duration => 0, pid => 1234 }, 'started services are up');
+is($statuses->{boot}->{status}, 'up', 'services started as dependencies are up');
+is($statuses->{mysql}->{status}, 'backoff', 'starting services are in backoff');
+is($statuses->{nginx}->{status}, 'down', 'stopping services are down');
+is_deeply([map { $statuses->{$_}->{status} } 'cron', 'tty1'], ['down', 'down'], 'stopped and failed services are down');
+is_deeply([$svsh->_service_dirs], [qw/boot cron mysql nginx sshd tty1/], 'services are those dinit loaded');
+
+is($svsh->suite_version, '0.17.1', 'the version of dinit is read from dinitctl');